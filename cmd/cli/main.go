@@ -2,55 +2,315 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/mwarzynski/crawler/internal/adapter/fetcher"
 	"github.com/mwarzynski/crawler/internal/app"
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	"github.com/mwarzynski/crawler/internal/app/crawler/filter"
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
 	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
 	"github.com/sirupsen/logrus"
 )
 
+const botName = "crawler-bot"
+
 func main() {
 	log := logrus.New()
 	log.SetLevel(logrus.DebugLevel)
 
+	outDir := flag.String("out", "",
+		"directory to write the sitemap files to (sitemap index is created if limits are exceeded)")
+	filesURL := flag.String("files-url", "",
+		"URL where the sitemap files are going to be hosted (default: root of the crawled site)")
+	gzip := flag.Bool("gzip", false, "compress the sitemap with gzip (files get the '.gz' extension)")
+	allowParams := flag.String("allow-params", "", "comma separated GET params to keep (all other params are removed)")
+	denyParams := flag.String("deny-params", "", "comma separated GET params to remove ('*' at the end matches prefixes)")
+	sortParams := flag.Bool("sort-params", false, "sort GET params by name")
+	keepTrackingParams := flag.Bool("keep-tracking-params", false,
+		"keep tracking params and session IDs (utm_*, fbclid, gclid, jsessionid, ...)")
+	trailingSlash := flag.String("trailing-slash", "keep", "trailing slash of the URL paths: keep, add or remove")
+	defaultOptions := crawler.DefaultCrawlOptions()
+	workers := flag.Int("workers", defaultOptions.Workers, "number of pages fetched concurrently")
+	maxPages := flag.Int("max-pages", 0, "maximum number of pages to fetch (0 means unlimited)")
+	maxDepth := flag.Int("max-depth", 0, "maximum number of links from the seed URL (0 means unlimited)")
+	timeout := flag.Duration("timeout", defaultOptions.Timeout, "maximum duration of the whole crawl (0 means unlimited)")
+	requestTimeout := flag.Duration("request-timeout", defaultOptions.RequestTimeout, "maximum duration of a single request")
+	scopeMode := flag.String("scope", string(crawler.ScopeHost), "crawled hosts: host, www, subdomains or hosts")
+	hosts := flag.String("hosts", "", "comma separated hosts crawled in the 'hosts' scope mode")
+	strictScheme := flag.Bool("strict-scheme", false, "don't treat http and https URLs as the same pages")
+	maxPathDepth := flag.Int("max-path-depth", defaultOptions.Traps.MaxPathDepth,
+		"crawl trap: maximum number of path segments (0 means unlimited)")
+	maxRepeatedSegments := flag.Int("max-repeated-segments", defaultOptions.Traps.MaxRepeatedSegments,
+		"crawl trap: maximum occurrences of the same path segment (0 means unlimited)")
+	maxURLsPerPattern := flag.Int("max-urls-per-pattern", defaultOptions.Traps.MaxURLsPerPattern,
+		"crawl trap: maximum URLs of the same path differing only by numeric params (0 means unlimited)")
+	maxCalendarURLs := flag.Int("max-calendar-urls", defaultOptions.Traps.MaxCalendarURLs,
+		"crawl trap: maximum URLs of the same path differing only by dates (0 means unlimited)")
+	var seeds listFlag
+	flag.Var(&seeds, "seed", "additional URL to start the crawl from (e.g. orphan page), might be repeated")
+	seedSitemaps := flag.Bool("seed-sitemaps", false,
+		"start the crawl also from URLs listed in the site's sitemaps (robots.txt Sitemap records or /sitemap.xml)")
+	queueType := flag.String("queue", string(crawler.QueueMemory), "queue of URLs to crawl: memory, ring or disk")
+	queueDir := flag.String("queue-dir", "", "directory of the disk queue files (default: system temporary directory)")
+	historyType := flag.String("history", string(crawler.HistoryMemory),
+		"history of processed URLs: memory, bloom (a few bytes per URL, might skip some URLs) or disk")
+	historyDir := flag.String("history-dir", "",
+		"directory of the disk history files (default: system temporary directory)")
+	historyCapacity := flag.Int("history-capacity", defaultOptions.History.Capacity,
+		"expected number of URLs (bloom and disk history grow if it's exceeded)")
+	historyFPRate := flag.Float64("history-fp-rate", defaultOptions.History.FalsePositiveRate,
+		"maximum probability that the bloom history skips a new URL")
+	var include, exclude, sitemapInclude, sitemapExclude listFlag
+	flag.Var(&include, "include", "crawl only URLs matching the pattern (glob, or regex with 're:' prefix), might be repeated")
+	flag.Var(&exclude, "exclude", "don't crawl URLs matching the pattern, might be repeated")
+	flag.Var(&sitemapInclude, "sitemap-include", "list in the sitemap only URLs matching the pattern, might be repeated")
+	flag.Var(&sitemapExclude, "sitemap-exclude", "crawl, but don't list in the sitemap URLs matching the pattern")
+	stateDir := flag.String("state-dir", "",
+		"directory of the crawl checkpoints, so the interrupted crawl might be resumed (disabled if empty)")
+	crawlID := flag.String("crawl-id", "", "ID of the crawl in the state directory (generated if empty)")
+	checkpointInterval := flag.Duration("checkpoint-interval", defaultOptions.Checkpoint.Interval,
+		"time between the checkpoints (0 means the checkpoint is saved only when the crawl is interrupted)")
+	resume := flag.Bool("resume", false,
+		"resume the crawl with -crawl-id from its last checkpoint (URL argument is optional, seeds are restored)")
+	incremental := flag.Bool("incremental", false,
+		"recrawl incrementally: conditional requests and links reused from the previous crawl (requires -state-dir)")
+	partial := flag.Bool("partial", false, "write the partial sitemap if the crawl times out or is interrupted (Ctrl+C)")
+	progress := flag.Bool("progress", false,
+		"show the live progress line on stderr (debug logs of the fetched pages are turned off)")
+	flag.Parse()
+
+	if *progress {
+		log.SetLevel(logrus.InfoLevel)
+	}
+
 	log.Info("Hello, I am your crawler!")
 
-	args := os.Args[1:]
-	if len(args) < 1 {
+	args := flag.Args()
+	if len(args) < 1 && !*resume {
 		log.Fatalf("You need to pass the URL as a first argument.")
 	}
 
-	urlRaw := args[0]
 	var sitemapType sitemap.Type = sitemap.TypePlaintext
 	if len(args) > 1 {
-		switch sitemap.Type(args[1]) {
-		case sitemap.TypePlaintext:
-			sitemapType = sitemap.TypePlaintext
-		case sitemap.TypeXML:
-			sitemapType = sitemap.TypeXML
-		default:
-			log.Fatalf("Invalid sitemap type.")
+		t, err := sitemap.ParseType(args[1])
+		if err != nil {
+			log.Fatalf("Invalid sitemap type (available: xml, plaintext, rss, atom).")
 		}
+		sitemapType = t
+	}
+
+	requestDelay, err := app.ParseRequestDelay(os.Getenv("REQUEST_DELAY"))
+	if err != nil {
+		log.Fatalf("invalid REQUEST_DELAY: %s", err)
 	}
 
 	fetcherCreator := func() http.Fetcher {
-		return fetcher.NewHTTPClient("crawler-bot", time.Minute, log)
+		return fetcher.NewHTTPClient(botName, time.Minute, log)
 	}
-	service := app.NewService(fetcherCreator, log)
+	service := app.NewService(botName, requestDelay, fetcherCreator, *stateDir, log)
 
-	u, err := url.Parse(urlRaw)
+	if *workers < 1 {
+		log.Fatalf("Number of workers must be positive.")
+	}
+	options := crawler.DefaultCrawlOptions()
+	options.Workers = *workers
+	options.MaxPages = *maxPages
+	options.MaxDepth = *maxDepth
+	options.Timeout = *timeout
+	options.RequestTimeout = *requestTimeout
+	options.PartialResults = *partial
+	options.SeedFromSitemaps = *seedSitemaps
+	if *maxPathDepth < 0 || *maxRepeatedSegments < 0 || *maxURLsPerPattern < 0 || *maxCalendarURLs < 0 {
+		log.Fatalf("Crawl trap limits must not be negative.")
+	}
+	options.Traps = crawler.TrapLimits{
+		MaxPathDepth:        *maxPathDepth,
+		MaxRepeatedSegments: *maxRepeatedSegments,
+		MaxURLsPerPattern:   *maxURLsPerPattern,
+		MaxCalendarURLs:     *maxCalendarURLs,
+	}
+	mode, err := crawler.ParseScopeMode(*scopeMode)
 	if err != nil {
-		log.Fatalf("couldn't parse url '%s' err: %s", urlRaw, err)
+		log.Fatalf("Invalid scope mode (available: host, www, subdomains, hosts).")
 	}
-	sitemap, err := service.GenerateSitemap(context.Background(), *u, sitemapType)
+	options.Scope = crawler.Scope{
+		Mode:         mode,
+		Hosts:        url_extractor.SplitList(*hosts),
+		StrictScheme: *strictScheme,
+	}
+	options.Queue.Type, err = crawler.ParseQueueType(*queueType)
+	if err != nil {
+		log.Fatalf("Invalid queue type (available: memory, ring, disk).")
+	}
+	options.Queue.Dir = *queueDir
+	options.History.Type, err = crawler.ParseHistoryType(*historyType)
 	if err != nil {
+		log.Fatalf("Invalid history type (available: memory, bloom, disk).")
+	}
+	options.History.Dir = *historyDir
+	options.History.Capacity = *historyCapacity
+	options.History.FalsePositiveRate = *historyFPRate
+	crawlFilter, err := filter.Parse(include, exclude)
+	if err != nil {
+		log.Fatalf("Invalid crawl filter: %s", err)
+	}
+	options.CrawlFilter = crawlFilter
+	sitemapFilter, err := filter.Parse(sitemapInclude, sitemapExclude)
+	if err != nil {
+		log.Fatalf("Invalid sitemap filter: %s", err)
+	}
+	options.SitemapFilter = sitemapFilter
+	options.URLNormalization.AllowedParams = url_extractor.SplitList(*allowParams)
+	options.URLNormalization.DeniedParams = url_extractor.SplitList(*denyParams)
+	options.URLNormalization.SortParams = *sortParams
+	options.URLNormalization.StripTrackingParams = !*keepTrackingParams
+	trailingSlashPolicy, err := url_extractor.ParseTrailingSlash(*trailingSlash)
+	if err != nil {
+		log.Fatalf("Invalid trailing slash policy (available: keep, add, remove).")
+	}
+	options.URLNormalization.TrailingSlash = trailingSlashPolicy
+
+	if *incremental && *stateDir == "" {
+		log.Fatalf("You need to pass -state-dir to crawl incrementally.")
+	}
+	options.Incremental.Enabled = *incremental
+	options.Checkpoint.Interval = *checkpointInterval
+	options.Checkpoint.Resume = *resume
+	options.Checkpoint.ID = *crawlID
+	switch {
+	case *resume && (*stateDir == "" || *crawlID == ""):
+		log.Fatalf("You need to pass -state-dir and -crawl-id to resume the crawl.")
+	case *stateDir != "" && *crawlID == "":
+		options.Checkpoint.ID = crawler.NewCrawlID()
+	}
+	if options.Checkpoint.ID != "" {
+		if err := crawler.ValidateCrawlID(options.Checkpoint.ID); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Crawl ID: %s (resume with -resume -crawl-id %s).", options.Checkpoint.ID, options.Checkpoint.ID)
+	}
+
+	// Resumed crawl might omit the URL, the seeds are restored from the checkpoint.
+	seedURLs := make([]url.URL, 0, len(seeds)+1)
+	if len(args) < 1 {
+		seeds = nil
+	} else {
+		seeds = append([]string{args[0]}, seeds...)
+	}
+	for _, seedRaw := range seeds {
+		u, err := url.Parse(seedRaw)
+		if err != nil {
+			log.Fatalf("couldn't parse url '%s' err: %s", seedRaw, err)
+		}
+		seedURLs = append(seedURLs, *u)
+	}
+	compression := sitemap.CompressionNone
+	if *gzip {
+		compression = sitemap.CompressionGzip
+	}
+
+	stopProgress := func() {}
+	if *progress {
+		events := make(chan crawler.Event, progressEventsBuffer)
+		options.Events = events
+		done := make(chan struct{})
+		go showProgress(os.Stderr, events, done)
+		// Manager doesn't publish the events once the crawl ends, so the channel might be closed.
+		stopProgress = func() {
+			close(events)
+			<-done
+		}
+	}
+
+	// Interrupted crawl ends with the partial sitemap (if it's allowed).
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Info("Interrupted, stopping the crawl.")
+		cancel()
+	}()
+
+	if *outDir == "" {
+		data, status, err := service.GenerateSitemap(ctx, seedURLs, sitemapType, options)
+		stopProgress()
+		if errors.Cause(err) == sitemap.ErrTooLarge {
+			log.Fatalf("%s, use -out to write the sitemap index and its files.", err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		warnPartial(log, status)
+		data, err = sitemap.Compress(data, compression)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s", string(data))
+		return
+	}
+
+	filesOptions := sitemap.FilesOptions{
+		Compression: compression,
+	}
+	if *filesURL != "" {
+		filesBaseURL, err := url.Parse(*filesURL)
+		if err != nil {
+			log.Fatalf("couldn't parse files url '%s' err: %s", *filesURL, err)
+		}
+		filesOptions.BaseURL = *filesBaseURL
+	}
+	files, status, err := service.GenerateSitemapFiles(ctx, seedURLs, sitemapType, options, filesOptions)
+	stopProgress()
+	if err != nil {
+		log.Fatal(err)
+	}
+	warnPartial(log, status)
+	if err := writeFiles(*outDir, files); err != nil {
 		log.Fatal(err)
 	}
+}
+
+func warnPartial(log logrus.FieldLogger, status crawler.Status) {
+	if status.Partial() {
+		log.Warnf("Sitemap is partial, crawl status: %s.", status)
+	}
+}
+
+func writeFiles(dir string, files []sitemap.File) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory '%s'", dir)
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name), file.Data, 0644); err != nil {
+			return errors.Wrapf(err, "writing file '%s'", file.Name)
+		}
+	}
+	return nil
+}
+
+// listFlag collects the values of the repeated flag (patterns might contain commas, so we can't split them).
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, " ")
+}
 
-	fmt.Printf("%s", string(sitemap))
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+)
+
+// progressEventsBuffer is the number of crawl events buffered for the progress line.
+const progressEventsBuffer = 1024
+
+// showProgress rewrites the progress line each time the progress event is received. It closes the done channel
+// once the events channel is closed.
+func showProgress(w io.Writer, events <-chan crawler.Event, done chan<- struct{}) {
+	defer close(done)
+	robotsSkipped := 0
+	shown := false
+	for event := range events {
+		switch event.Type {
+		case crawler.EventRobotsSkipped:
+			robotsSkipped++
+		case crawler.EventProgress:
+			// Trailing spaces clear the rest of the previous line (it might have been longer).
+			fmt.Fprintf(w, "\r%s: fetched %d, failed %d, retried %d, discovered %d, skipped by robots %d, "+
+				"queued %d, active workers %d    ",
+				event.Status, event.Stats.Fetched, event.Stats.Failed, event.Stats.Retried, event.Stats.Processed,
+				robotsSkipped, event.Queued, event.ActiveWorkers)
+			shown = true
+		}
+	}
+	if shown {
+		fmt.Fprintln(w)
+	}
+}
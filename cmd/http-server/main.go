@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -12,21 +13,47 @@ import (
 	httpAPI "github.com/mwarzynski/crawler/internal/transport/http"
 )
 
+const botName = "crawler-bot"
+
 func main() {
 	log := logrus.New()
 
 	// Create application service.
+	requestDelay, err := app.ParseRequestDelay(os.Getenv("REQUEST_DELAY"))
+	if err != nil {
+		log.Fatalf("invalid REQUEST_DELAY: %s", err)
+	}
 	fetcherCreator := func() http.Fetcher {
-		return fetcher.NewHTTPClient("crawler-bot", time.Minute, log)
+		return fetcher.NewHTTPClient(botName, time.Minute, log)
+	}
+	// Crawls started with crawl_id are checkpointed in the state directory, so they might be resumed after restart.
+	service := app.NewService(botName, requestDelay, fetcherCreator, os.Getenv("STATE_DIR"), log)
+
+	// Crawls started in the background are kept until their results expire.
+	maxCrawls := app.DefaultMaxCrawls
+	if limit := os.Getenv("MAX_CRAWLS"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			log.Fatalf("invalid MAX_CRAWLS '%s'", limit)
+		}
+		maxCrawls = l
+	}
+	crawlRetention := app.DefaultCrawlRetention
+	if retention := os.Getenv("CRAWL_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			log.Fatalf("invalid CRAWL_RETENTION '%s': %s", retention, err)
+		}
+		crawlRetention = d
 	}
-	service := app.NewService(fetcherCreator, log)
+	crawls := app.NewCrawlStore(maxCrawls, crawlRetention)
 
 	// Create HTTP server.
 	listenAddr := "localhost:8000"
 	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
 		listenAddr = addr
 	}
-	if err := httpAPI.Init(listenAddr, service, log.WithField("component", "http")); err != nil {
+	if err := httpAPI.Init(listenAddr, service, crawls, log.WithField("component", "http")); err != nil {
 		log.Errorf("http API: %s", err.Error())
 	}
 }
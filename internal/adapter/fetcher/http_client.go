@@ -24,36 +24,62 @@ func NewHTTPClient(name string, timeout time.Duration, log logging.Logger) *HTTP
 	return &HTTPClient{
 		httpDoer: &http.Client{
 			Timeout: timeout,
+			// Redirects are handled by the crawler (each hop is a separate job).
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
 		},
 		name: name,
 		log:  logging.WithFields(log, "fetcher", "HTTPClient"),
 	}
 }
 
-func (s *HTTPClient) Fetch(ctx context.Context, url url.URL) ([]byte, int, error) {
+func (s *HTTPClient) Fetch(ctx context.Context, url url.URL, options chttp.FetchOptions) (*chttp.Response, error) {
 	s.log.Debugf("Fetching URL=%s", url.String())
 	req, err := http.NewRequest(http.MethodGet, url.String(), nil)
 	if err != nil {
-		return nil, 0, errors.Wrap(err, "couldn't create request")
+		return nil, errors.Wrap(err, "couldn't create request")
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("User-Agent", s.name)
+	// Page fetched by the previous crawl is requested conditionally (server responds with 304 if it didn't change).
+	if options.Validators.ETag != "" {
+		req.Header.Set("If-None-Match", options.Validators.ETag)
+	}
+	if options.Validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", options.Validators.LastModified)
+	}
+	start := time.Now()
 	resp, err := s.httpDoer.Do(req)
 	if err != nil {
-		return nil, 0, errors.Wrap(err, "couldn't do HTTP request")
+		return nil, errors.Wrap(err, "couldn't do HTTP request")
 	}
 	if resp == nil {
-		return nil, 0, errors.Errorf("body is nil")
+		return nil, errors.Errorf("body is nil")
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	response := &chttp.Response{
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		URL:           *resp.Request.URL,
+		ContentLength: resp.ContentLength,
+		Protocol:      resp.Proto,
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, resp.StatusCode, chttp.ErrInvalidStatusCode
+		response.Duration = time.Since(start)
+		return response, chttp.ErrInvalidStatusCode
 	}
 	if resp.Body == nil {
-		return nil, resp.StatusCode, errors.Errorf("body is nil")
+		return response, errors.Errorf("body is nil")
 	}
-	reader := io.LimitReader(resp.Body, 10*1024*1024) // Limit reading body to 10MB.
+	reader := io.LimitReader(resp.Body, options.BodyLimit())
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return nil, resp.StatusCode, errors.Wrap(err, "reading request body")
+		return response, errors.Wrap(err, "reading request body")
 	}
-	return data, resp.StatusCode, nil
+	response.Body = data
+	response.Duration = time.Since(start)
+	return response, nil
 }
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
+)
+
+// crawlEventsBuffer is the number of events buffered for the crawl and for each of its subscribers.
+const crawlEventsBuffer = 1024
+
+// ErrCrawlRunning is returned when the results of the crawl which is still running are requested.
+var ErrCrawlRunning = errors.New("crawl is still running")
+
+// Crawl is the crawl running in the background (see Service.NewCrawl).
+type Crawl struct {
+	ID      string
+	Seeds   []url.URL
+	Created time.Time
+
+	manager *crawler.Manager
+	run     func(ctx context.Context, manager *crawler.Manager) (*sitemap.Generator, crawler.Status, error)
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+	done    chan struct{}
+	events  chan crawler.Event
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan crawler.Event]struct{}
+	closed        bool
+
+	mu        sync.Mutex
+	finished  time.Time
+	status    crawler.Status
+	generator *sitemap.Generator
+	err       error
+	// files are the last generated sitemap files (requested by the key: type and files options).
+	files    []sitemap.File
+	filesKey string
+}
+
+// NewCrawl prepares the crawl which runs in the background once it's started. Crawl ID is also the ID of its
+// checkpoints, so the crawl might be resumed after restart (if the service has the state directory).
+// Partial sitemap of the cancelled crawl is always kept (status tells if it's complete).
+func (s *Service) NewCrawl(seeds []url.URL, options crawler.CrawlOptions) (*Crawl, error) {
+	if options.Checkpoint.ID == "" {
+		options.Checkpoint.ID = crawler.NewCrawlID()
+	}
+	options.PartialResults = true
+	events := make(chan crawler.Event, crawlEventsBuffer)
+	options.Events = events
+	manager, err := s.newManager(seeds, options)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Crawl{
+		ID:      options.Checkpoint.ID,
+		Seeds:   seeds,
+		Created: time.Now(),
+		manager: manager,
+		run:     s.run,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		events:  events,
+		status:  crawler.StatusRunning,
+
+		subscribers: make(map[chan crawler.Event]struct{}),
+	}, nil
+}
+
+// Start runs the crawl in the background (subsequent calls do nothing).
+func (c *Crawl) Start() {
+	c.once.Do(func() {
+		go c.broadcast()
+		go func() {
+			generator, status, err := c.run(c.ctx, c.manager)
+			c.mu.Lock()
+			c.finished = time.Now()
+			c.generator, c.status, c.err = generator, status, err
+			c.mu.Unlock()
+			c.cancel()
+			close(c.done)
+		}()
+	})
+}
+
+// Subscribe returns the channel with the events of the crawl, which is closed when the crawl ends (or when
+// the returned function is called). Events are dropped if the subscriber doesn't keep up.
+func (c *Crawl) Subscribe() (<-chan crawler.Event, func()) {
+	events := make(chan crawler.Event, crawlEventsBuffer)
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+	if c.closed {
+		close(events)
+		return events, func() {}
+	}
+	c.subscribers[events] = struct{}{}
+	return events, func() {
+		c.subscribersMu.Lock()
+		defer c.subscribersMu.Unlock()
+		if _, ok := c.subscribers[events]; ok {
+			delete(c.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// broadcast sends the events published by the manager to the subscribers until the crawl ends.
+func (c *Crawl) broadcast() {
+	for {
+		select {
+		case event := <-c.events:
+			c.send(event)
+		case <-c.done:
+			// Manager doesn't publish anymore, but some events might be still buffered.
+			for {
+				select {
+				case event := <-c.events:
+					c.send(event)
+				default:
+					c.closeSubscribers()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Crawl) send(event crawler.Event) {
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+	for subscriber := range c.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (c *Crawl) closeSubscribers() {
+	c.subscribersMu.Lock()
+	defer c.subscribersMu.Unlock()
+	for subscriber := range c.subscribers {
+		delete(c.subscribers, subscriber)
+		close(subscriber)
+	}
+	c.closed = true
+}
+
+// Cancel stops the running crawl, the partial sitemap is kept.
+func (c *Crawl) Cancel() {
+	c.cancel()
+}
+
+// Done is closed when the crawl ends.
+func (c *Crawl) Done() <-chan struct{} {
+	return c.done
+}
+
+// Status returns the status of the crawl (StatusRunning until it ends).
+func (c *Crawl) Status() crawler.Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Stats returns the progress counters of the crawl.
+func (c *Crawl) Stats() crawler.Stats {
+	return c.manager.Stats()
+}
+
+// Finished returns the time when the crawl ended (false if it's still running).
+func (c *Crawl) Finished() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.finished, !c.finished.IsZero()
+}
+
+// Err returns the error which ended the crawl.
+func (c *Crawl) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// SitemapFiles generates the sitemap of the crawl which ended (it might be partial, see Status). The first file
+// is the sitemap or, if the limits of a single file are exceeded, the sitemap index of the other files.
+func (c *Crawl) SitemapFiles(t sitemap.Type, options sitemap.FilesOptions) ([]sitemap.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished.IsZero() {
+		return nil, ErrCrawlRunning
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	// Child sitemaps are requested one by one, so the files aren't generated again for each of them.
+	key := fmt.Sprintf("%s %+v", t, options)
+	if c.files != nil && c.filesKey == key {
+		return c.files, nil
+	}
+	files, err := c.generator.GenerateFiles(t, options)
+	if err != nil {
+		return nil, err
+	}
+	c.files, c.filesKey = files, key
+	return files, nil
+}
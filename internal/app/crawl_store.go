@@ -0,0 +1,107 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxCrawls is the default number of crawls kept by the store (running and finished).
+	DefaultMaxCrawls = 100
+	// DefaultCrawlRetention is the default time the results of the finished crawl are kept.
+	DefaultCrawlRetention = time.Hour
+)
+
+var (
+	ErrCrawlNotFound = errors.New("crawl not found")
+	ErrCrawlExists   = errors.New("crawl with the same ID is already in the store")
+	ErrTooManyCrawls = errors.New("too many crawls, try again later")
+)
+
+// CrawlStore keeps the crawls started in the background. It's bounded: finished crawls are removed after
+// the retention time (or earlier, the oldest first, if the store is full). If all crawls in the full store
+// are still running, new crawls are rejected.
+type CrawlStore struct {
+	limit     int
+	retention time.Duration
+
+	mu     sync.Mutex
+	crawls map[string]*Crawl
+	// order are the crawl IDs from the oldest to the newest.
+	order []string
+}
+
+func NewCrawlStore(limit int, retention time.Duration) *CrawlStore {
+	return &CrawlStore{
+		limit:     limit,
+		retention: retention,
+		crawls:    make(map[string]*Crawl),
+	}
+}
+
+func (s *CrawlStore) Add(c *Crawl) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	if _, ok := s.crawls[c.ID]; ok {
+		return ErrCrawlExists
+	}
+	if len(s.crawls) >= s.limit && !s.evictFinished() {
+		return ErrTooManyCrawls
+	}
+	s.crawls[c.ID] = c
+	s.order = append(s.order, c.ID)
+	return nil
+}
+
+func (s *CrawlStore) Get(id string) (*Crawl, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	c, ok := s.crawls[id]
+	if !ok {
+		return nil, ErrCrawlNotFound
+	}
+	return c, nil
+}
+
+func (s *CrawlStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+}
+
+// expire removes the finished crawls older than the retention time.
+func (s *CrawlStore) expire(now time.Time) {
+	for _, id := range append([]string{}, s.order...) {
+		if finished, ok := s.crawls[id].Finished(); ok && now.Sub(finished) >= s.retention {
+			s.remove(id)
+		}
+	}
+}
+
+// evictFinished removes the oldest finished crawl. It returns false if all crawls are running.
+func (s *CrawlStore) evictFinished() bool {
+	for _, id := range s.order {
+		if _, ok := s.crawls[id].Finished(); ok {
+			s.remove(id)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CrawlStore) remove(id string) {
+	if _, ok := s.crawls[id]; !ok {
+		return
+	}
+	delete(s.crawls, id)
+	for i := range s.order {
+		if s.order[i] == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func testCrawl(id string, finished time.Time) *Crawl {
+	return &Crawl{ID: id, done: make(chan struct{}), finished: finished}
+}
+
+func TestCrawlStore(t *testing.T) {
+	now := time.Now()
+	store := NewCrawlStore(2, time.Hour)
+
+	if err := store.Add(testCrawl("running", time.Time{})); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+	if err := store.Add(testCrawl("running", time.Time{})); err != ErrCrawlExists {
+		t.Errorf("add duplicate: expected %s, got %v", ErrCrawlExists, err)
+	}
+	if err := store.Add(testCrawl("finished", now)); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+	// Store is full, the oldest finished crawl is evicted.
+	if err := store.Add(testCrawl("new", time.Time{})); err != nil {
+		t.Fatalf("add to full store: %s", err)
+	}
+	if _, err := store.Get("finished"); err != ErrCrawlNotFound {
+		t.Errorf("get evicted: expected %s, got %v", ErrCrawlNotFound, err)
+	}
+	// All crawls are running.
+	if err := store.Add(testCrawl("rejected", time.Time{})); err != ErrTooManyCrawls {
+		t.Errorf("add to full store: expected %s, got %v", ErrTooManyCrawls, err)
+	}
+
+	store.Remove("new")
+	if err := store.Add(testCrawl("expired", now.Add(-2*time.Hour))); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+	if _, err := store.Get("expired"); err != ErrCrawlNotFound {
+		t.Errorf("get expired: expected %s, got %v", ErrCrawlNotFound, err)
+	}
+	if _, err := store.Get("running"); err != nil {
+		t.Errorf("get running: %s", err)
+	}
+}
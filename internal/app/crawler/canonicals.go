@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+)
+
+// CanonicalIssue describes the problematic canonical declaration: a chain (canonical URL declares yet another
+// canonical) or a canonical URL on a different host.
+type CanonicalIssue struct {
+	URL url.URL
+	// Chain is the sequence of declarations starting at URL (URL -> its canonical -> canonical of the canonical...).
+	Chain     []url.URL
+	CrossHost bool
+}
+
+// canonicals keeps the canonical URLs declared by the fetched pages (only if they differ from the page URL).
+type canonicals struct {
+	declared map[string]url.URL
+}
+
+func newCanonicals() *canonicals {
+	return &canonicals{
+		declared: make(map[string]url.URL),
+	}
+}
+
+func (c *canonicals) Add(page url.URL, canonical url.URL) {
+	if page.String() == canonical.String() {
+		return
+	}
+	c.declared[page.String()] = canonical
+}
+
+// chain follows the declarations starting at the page. It stops at the self-canonical page or on the loop.
+func (c *canonicals) chain(page url.URL) (chain []url.URL, loop bool) {
+	chain = []url.URL{page}
+	visited := map[string]bool{page.String(): true}
+	current := page
+	for {
+		next, ok := c.declared[current.String()]
+		if !ok {
+			return chain, false
+		}
+		if visited[next.String()] {
+			return chain, true
+		}
+		visited[next.String()] = true
+		chain = append(chain, next)
+		current = next
+	}
+}
+
+// Resolve returns the URL which should be used in the sitemap instead of the page: the last in-scope URL of
+// the canonical chain. If the chain is a loop, the page itself is used.
+func (c *canonicals) Resolve(page url.URL, allowed func(url.URL) bool) url.URL {
+	chain, loop := c.chain(page)
+	if loop {
+		return page
+	}
+	resolved := page
+	for _, u := range chain[1:] {
+		if !allowed(u) {
+			break
+		}
+		resolved = u
+	}
+	return resolved
+}
+
+func (c *canonicals) Issues() []CanonicalIssue {
+	pages := make([]string, 0, len(c.declared))
+	for page := range c.declared {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+
+	issues := make([]CanonicalIssue, 0)
+	for _, page := range pages {
+		u, err := url.Parse(page)
+		if err != nil {
+			continue
+		}
+		chain, loop := c.chain(*u)
+		crossHost := c.declared[page].Host != u.Host
+		if len(chain) > 2 || loop || crossHost {
+			issues = append(issues, CanonicalIssue{
+				URL:       *u,
+				Chain:     chain,
+				CrossHost: crossHost,
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,509 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler/queue"
+	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
+)
+
+// ErrCheckpointNotFound is returned when the crawl is resumed, but there is no checkpoint with its ID.
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// ErrInvalidCheckpointOptions is returned when the options saved in the checkpoint are rejected by
+// CrawlOptions.ResumeCheck.
+var ErrInvalidCheckpointOptions = errors.New("options saved in the checkpoint are invalid")
+
+// crawlIDRegexp limits the crawl IDs to the safe directory names.
+var crawlIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+const checkpointFile = "checkpoint.json"
+
+// CheckpointOptions configure saving the state of the crawl (frontier, history, in-flight URLs and collected
+// entries), so it might be resumed after a crash or restart.
+type CheckpointOptions struct {
+	// Dir is the state directory, checkpoints of each crawl are kept in the subdirectory named by the crawl ID.
+	Dir string
+	// ID identifies the crawl. Checkpoints are saved only if both Dir and ID are set.
+	ID string
+	// Interval is the time between the checkpoints (0 means the checkpoint is saved only when the crawl is
+	// cancelled or times out).
+	Interval time.Duration
+	// Resume continues the crawl from its last checkpoint instead of starting at the seeds.
+	Resume bool
+}
+
+func (o CheckpointOptions) enabled() bool {
+	return o.Dir != "" && o.ID != ""
+}
+
+// NewCrawlID generates a new unique crawl ID (e.g. '20190628T120000-1a2b3c4d').
+func NewCrawlID() string {
+	random := make([]byte, 4)
+	_, _ = rand.Read(random)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(random)
+}
+
+func ValidateCrawlID(id string) error {
+	if !crawlIDRegexp.MatchString(id) {
+		return errors.Errorf("invalid crawl ID '%s', it might contain only letters, digits, '-' and '_'", id)
+	}
+	return nil
+}
+
+// CheckpointSeeds returns the seeds of the crawl saved in the checkpoint (so the crawl might be resumed by its ID).
+func CheckpointSeeds(dir string, id string) ([]url.URL, error) {
+	c, err := readCheckpoint(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	seeds := make([]url.URL, 0, len(c.Seeds))
+	for _, seed := range c.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid seed '%s'", seed)
+		}
+		seeds = append(seeds, *u)
+	}
+	return seeds, nil
+}
+
+// checkpoint is the saved state of the crawl. Frontier and history might be large, so they are saved in separate
+// files (suffixed with the generation). checkpoint.json is replaced atomically after these files are written,
+// so it always points to the complete state.
+type checkpoint struct {
+	Generation  int
+	Seeds       []string
+	HistoryType HistoryType
+	// Options are the effective options of the crawl (nil in checkpoints saved by the older versions).
+	Options *CrawlOptions
+	// Pending are the in-flight and retried jobs, they are scheduled again when the crawl is resumed.
+	Pending []checkpointJob
+	// Parked are the URLs waiting for the robots rules of their hosts, they are added again when the crawl is resumed.
+	Parked     []checkpointJob
+	Entries    []checkpointEntry
+	Canonicals map[string]string
+	Failures   []checkpointFailure
+	// Pages are the states of the pages fetched by the crawl (in the incremental mode).
+	Pages      []pageState
+	Dispatched int
+	Stats      Stats
+	// SeedingSitemaps is set if the crawl was seeded from the sitemaps, which weren't fetched completely.
+	SeedingSitemaps bool
+	Redirects       map[string]checkpointRedirect
+	// TrapPatterns are the numbers of URLs crawled for the patterns limited by the trap heuristics.
+	TrapPatterns map[string]int
+	Truncations  []checkpointTruncation
+}
+
+type checkpointJob struct {
+	URL     string
+	Depth   int
+	Attempt int
+}
+
+type checkpointEntry struct {
+	Location        string
+	Title           string
+	LastModified    time.Time
+	Alternates      []checkpointAlternate
+	ChangeFrequency sitemap.Frequency
+	Priority        float64
+}
+
+type checkpointAlternate struct {
+	Language string
+	Location string
+}
+
+type checkpointRedirect struct {
+	Location   string
+	StatusCode int
+}
+
+type checkpointTruncation struct {
+	Pattern string
+	Reason  string
+	Skipped int
+	Example string
+}
+
+type checkpointFailure struct {
+	URL        string
+	StatusCode int
+	Attempts   int
+	Reason     string
+}
+
+// ResumeOptions returns the options of the crawl saved in its checkpoint, so the resumed crawl continues with
+// the same settings. Checkpoint, Events, PartialResults (how the results are returned) and the queue and history
+// directories are kept from the given options.
+func ResumeOptions(options CrawlOptions) (CrawlOptions, error) {
+	c, err := readCheckpoint(options.Checkpoint.Dir, options.Checkpoint.ID)
+	if err != nil {
+		return options, err
+	}
+	if c.Options == nil {
+		return options, nil
+	}
+	saved := *c.Options
+	saved.Checkpoint, saved.Events, saved.PartialResults = options.Checkpoint, options.Events, options.PartialResults
+	saved.Queue.Dir, saved.History.Dir = options.Queue.Dir, options.History.Dir
+	saved.ResumeCheck = options.ResumeCheck
+	if options.ResumeCheck != nil {
+		if err := options.ResumeCheck(saved); err != nil {
+			return options, errors.Wrap(ErrInvalidCheckpointOptions, err.Error())
+		}
+	}
+	return saved, nil
+}
+
+func checkpointDir(dir string, id string) string {
+	return filepath.Join(dir, id)
+}
+
+func frontierFile(generation int) string {
+	return fmt.Sprintf("frontier-%08d", generation)
+}
+
+func historyFile(generation int) string {
+	return fmt.Sprintf("history-%08d", generation)
+}
+
+func readCheckpoint(dir string, id string) (*checkpoint, error) {
+	if err := ValidateCrawlID(id); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(checkpointDir(dir, id), checkpointFile))
+	if os.IsNotExist(err) {
+		return nil, ErrCheckpointNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading checkpoint")
+	}
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "decoding checkpoint")
+	}
+	return &c, nil
+}
+
+// checkpointDue checks if the periodic checkpoint should be saved.
+func (m *Manager) checkpointDue() bool {
+	options := m.options.Checkpoint
+	return options.enabled() && options.Interval > 0 && time.Since(m.lastCheckpoint) >= options.Interval
+}
+
+// saveCheckpoint saves the state of the crawl. Job taken from the queue, but not sent to the processor yet
+// (next) is saved as pending.
+func (m *Manager) saveCheckpoint(next *job) error {
+	m.lastCheckpoint = time.Now()
+	dir := checkpointDir(m.options.Checkpoint.Dir, m.options.Checkpoint.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory '%s'", dir)
+	}
+	generation := m.checkpointGeneration + 1
+	if err := writeFileSync(filepath.Join(dir, frontierFile(generation)), m.queue.Save); err != nil {
+		return errors.Wrap(err, "saving frontier")
+	}
+	if err := writeFileSync(filepath.Join(dir, historyFile(generation)), m.history.Save); err != nil {
+		return errors.Wrap(err, "saving history")
+	}
+
+	c := m.checkpoint(next)
+	c.Generation = generation
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "encoding checkpoint")
+	}
+	tmp := filepath.Join(dir, checkpointFile+".tmp")
+	if err := writeFileSync(tmp, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, checkpointFile)); err != nil {
+		return errors.Wrap(err, "replacing checkpoint")
+	}
+
+	// Files of the previous checkpoint aren't needed anymore.
+	os.Remove(filepath.Join(dir, frontierFile(m.checkpointGeneration)))
+	os.Remove(filepath.Join(dir, historyFile(m.checkpointGeneration)))
+	m.checkpointGeneration = generation
+	return nil
+}
+
+func (m *Manager) checkpoint(next *job) checkpoint {
+	options := m.options
+	c := checkpoint{
+		HistoryType: m.options.History.Type,
+		Options:     &options,
+		Canonicals:  make(map[string]string),
+		Dispatched:  m.dispatched,
+		// Seeding starts over on resume, pages added before are skipped by the history.
+		SeedingSitemaps: m.seedingSitemaps || m.sitemapPages != nil,
+	}
+	for _, seed := range m.seeds {
+		c.Seeds = append(c.Seeds, seed.String())
+	}
+	pending := make([]job, 0, len(m.inFlight)+m.retries.Len()+1)
+	for _, j := range m.inFlight {
+		pending = append(pending, j)
+	}
+	for _, dj := range m.retries.jobs {
+		pending = append(pending, dj.job)
+	}
+	if next != nil {
+		pending = append(pending, *next)
+	}
+	for _, j := range pending {
+		c.Pending = append(c.Pending, checkpointJob{URL: j.url.String(), Depth: j.depth, Attempt: j.attempt})
+	}
+	for _, items := range m.parked {
+		for _, item := range items {
+			c.Parked = append(c.Parked, checkpointJob{URL: item.URL.String(), Depth: item.Depth})
+		}
+	}
+	for _, entry := range m.sitemapGenerator.Entries {
+		c.Entries = append(c.Entries, newCheckpointEntry(entry))
+	}
+	for _, state := range m.pages.current {
+		c.Pages = append(c.Pages, state)
+	}
+
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	for page, canonical := range m.canonicals.declared {
+		c.Canonicals[page] = canonical.String()
+	}
+	for _, failure := range m.failures {
+		c.Failures = append(c.Failures, checkpointFailure{
+			URL:        failure.URL.String(),
+			StatusCode: failure.StatusCode,
+			Attempts:   failure.Attempts,
+			Reason:     failure.Reason,
+		})
+	}
+	c.Stats = m.stats
+	c.Redirects = make(map[string]checkpointRedirect, len(m.redirects.targets))
+	for from, target := range m.redirects.targets {
+		c.Redirects[from] = checkpointRedirect{Location: target.location.String(), StatusCode: target.statusCode}
+	}
+	c.TrapPatterns = m.traps.patterns
+	for _, key := range m.traps.order {
+		truncation := m.traps.truncations[key]
+		c.Truncations = append(c.Truncations, checkpointTruncation{
+			Pattern: truncation.Pattern,
+			Reason:  truncation.Reason,
+			Skipped: truncation.Skipped,
+			Example: truncation.Example.String(),
+		})
+	}
+	return c
+}
+
+// restoreCheckpoint loads the state of the crawl saved by saveCheckpoint. Pending jobs are scheduled immediately,
+// robots rules of the parked URLs are fetched again.
+func (m *Manager) restoreCheckpoint(ctx context.Context) error {
+	c, err := readCheckpoint(m.options.Checkpoint.Dir, m.options.Checkpoint.ID)
+	if err != nil {
+		return err
+	}
+	if c.HistoryType != m.options.History.Type {
+		return errors.Errorf("checkpoint was saved with '%s' history, but '%s' history is configured",
+			c.HistoryType, m.options.History.Type)
+	}
+	dir := checkpointDir(m.options.Checkpoint.Dir, m.options.Checkpoint.ID)
+	if err := m.restoreFrontier(filepath.Join(dir, frontierFile(c.Generation))); err != nil {
+		return err
+	}
+	history, err := os.Open(filepath.Join(dir, historyFile(c.Generation)))
+	if err != nil {
+		return errors.Wrap(err, "opening history")
+	}
+	defer history.Close()
+	if err := m.history.Load(bufio.NewReader(history)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, pending := range c.Pending {
+		u, err := url.Parse(pending.URL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pending url '%s'", pending.URL)
+		}
+		m.retries.Push(job{
+			url:        *u,
+			depth:      pending.Depth,
+			attempt:    pending.Attempt,
+			validators: m.pages.Validators(*u),
+		}, now)
+	}
+	for _, parked := range c.Parked {
+		u, err := url.Parse(parked.URL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid parked url '%s'", parked.URL)
+		}
+		m.addURL(ctx, *u, parked.Depth)
+	}
+	if c.SeedingSitemaps {
+		m.seedingSitemaps = true
+		m.requestRobotsRules(ctx, m.baseURL)
+	}
+	for _, e := range c.Entries {
+		entry, err := e.entry()
+		if err != nil {
+			return err
+		}
+		m.sitemapGenerator.AddEntry(entry)
+	}
+	for _, state := range c.Pages {
+		m.pages.Set(state)
+	}
+
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	for page, canonical := range c.Canonicals {
+		u, err := url.Parse(canonical)
+		if err != nil {
+			return errors.Wrapf(err, "invalid canonical url '%s'", canonical)
+		}
+		m.canonicals.declared[page] = *u
+	}
+	for _, f := range c.Failures {
+		u, err := url.Parse(f.URL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid failed url '%s'", f.URL)
+		}
+		m.failures = append(m.failures, Failure{URL: *u, StatusCode: f.StatusCode, Attempts: f.Attempts, Reason: f.Reason})
+	}
+	for from, target := range c.Redirects {
+		u, err := url.Parse(target.Location)
+		if err != nil {
+			return errors.Wrapf(err, "invalid redirect location '%s'", target.Location)
+		}
+		m.redirects.targets[from] = redirectTarget{location: *u, statusCode: target.StatusCode}
+	}
+	for pattern, count := range c.TrapPatterns {
+		m.traps.patterns[pattern] = count
+	}
+	for _, t := range c.Truncations {
+		u, err := url.Parse(t.Example)
+		if err != nil {
+			return errors.Wrapf(err, "invalid truncation example '%s'", t.Example)
+		}
+		key := truncationKey(t.Reason, t.Pattern)
+		m.traps.truncations[key] = &Truncation{Pattern: t.Pattern, Reason: t.Reason, Skipped: t.Skipped, Example: *u}
+		m.traps.order = append(m.traps.order, key)
+	}
+	m.stats = c.Stats
+	m.stats.Processed = m.history.Len()
+	m.stats.HistoryMemory = m.history.MemoryUsage()
+	m.dispatched = c.Dispatched
+	m.checkpointGeneration = c.Generation
+	return nil
+}
+
+func (m *Manager) restoreFrontier(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Wrap(err, "opening frontier")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var item queue.Item
+		if err := item.UnmarshalText(scanner.Bytes()); err != nil {
+			return errors.Wrap(err, "reading frontier")
+		}
+		m.queue.Push(item)
+	}
+	return errors.Wrap(scanner.Err(), "reading frontier")
+}
+
+// removeCheckpoint removes the checkpoints of the crawl which was completed.
+func (m *Manager) removeCheckpoint() {
+	if !m.options.Checkpoint.enabled() {
+		return
+	}
+	if err := os.RemoveAll(checkpointDir(m.options.Checkpoint.Dir, m.options.Checkpoint.ID)); err != nil {
+		m.log.Infof("removing checkpoint: %s", err)
+	}
+}
+
+func newCheckpointEntry(entry sitemap.Entry) checkpointEntry {
+	e := checkpointEntry{
+		Location:        entry.Location.String(),
+		Title:           entry.Title,
+		LastModified:    entry.LastModified,
+		ChangeFrequency: entry.ChangeFrequency,
+		Priority:        entry.Priority,
+	}
+	for _, alternate := range entry.Alternates {
+		e.Alternates = append(e.Alternates, checkpointAlternate{
+			Language: alternate.Language,
+			Location: alternate.Location.String(),
+		})
+	}
+	return e
+}
+
+func (e checkpointEntry) entry() (sitemap.Entry, error) {
+	location, err := url.Parse(e.Location)
+	if err != nil {
+		return sitemap.Entry{}, errors.Wrapf(err, "invalid entry url '%s'", e.Location)
+	}
+	entry := sitemap.Entry{
+		Location:        *location,
+		Title:           e.Title,
+		LastModified:    e.LastModified,
+		ChangeFrequency: e.ChangeFrequency,
+		Priority:        e.Priority,
+	}
+	for _, a := range e.Alternates {
+		u, err := url.Parse(a.Location)
+		if err != nil {
+			return sitemap.Entry{}, errors.Wrapf(err, "invalid alternate url '%s'", a.Location)
+		}
+		entry.Alternates = append(entry.Alternates, sitemap.Alternate{Language: a.Language, Location: *u})
+	}
+	return entry, nil
+}
+
+// writeFileSync writes the file and flushes it to disk, so it survives the crash of the machine.
+func writeFileSync(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "creating '%s'", name)
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "writing '%s'", name)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "writing '%s'", name)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "syncing '%s'", name)
+	}
+	return errors.Wrapf(f.Close(), "closing '%s'", name)
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+)
+
+// progressInterval is the interval between the progress events.
+const progressInterval = time.Second
+
+// EventType describes what happened during the crawl.
+type EventType string
+
+const (
+	// EventDiscovered means that the new URL was added to the queue.
+	EventDiscovered EventType = "discovered"
+	// EventFetched means that the page was fetched (including redirects and not modified pages).
+	EventFetched EventType = "fetched"
+	// EventFailed means that the URL couldn't be processed (after all retries).
+	EventFailed EventType = "failed"
+	// EventRobotsSkipped means that the URL was skipped, because robots.txt disallows it.
+	EventRobotsSkipped EventType = "robots_skipped"
+	// EventProgress is published periodically with the queue size, active workers and stats of the crawl.
+	EventProgress EventType = "progress"
+)
+
+// Event is published by the Manager on the CrawlOptions.Events channel.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// URL, Depth, StatusCode and Reason describe the page (not set in the progress events).
+	URL        url.URL
+	Depth      int
+	StatusCode int
+	Reason     string
+	// Queued, ActiveWorkers, Status and Stats are set in the progress events.
+	Queued        int
+	ActiveWorkers int
+	Status        Status
+	Stats         Stats
+}
+
+// publish sends the event without blocking the crawl (event is dropped if the channel is full).
+func (m *Manager) publish(event Event) {
+	if m.options.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	select {
+	case m.options.Events <- event:
+	default:
+	}
+}
+
+// publishProgress publishes the progress event. It's published every progressInterval and when the crawl ends.
+func (m *Manager) publishProgress(activeWorkers int) {
+	if m.options.Events == nil {
+		return
+	}
+	queued := m.retries.Len()
+	for _, items := range m.parked {
+		queued += len(items)
+	}
+	if m.queue != nil {
+		queued += m.queue.Len()
+	}
+	m.publish(Event{
+		Type:          EventProgress,
+		Queued:        queued,
+		ActiveWorkers: activeWorkers,
+		Status:        m.Status(),
+		Stats:         m.Stats(),
+	})
+}
@@ -0,0 +1,117 @@
+package filter
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// regexPrefix marks the pattern as a regular expression, other patterns are globs.
+const regexPrefix = "re:"
+
+// Pattern matches the path (with the query, if present) of the URL, e.g. '/docs/index.html?lang=en'.
+// Glob patterns must match the whole path: '*' matches any sequence of characters (including '/'),
+// '?' matches a single character. Regular expressions ('re:' prefix) match any part of the path.
+type Pattern struct {
+	raw    string
+	regexp *regexp.Regexp
+}
+
+func ParsePattern(v string) (Pattern, error) {
+	expr := ""
+	if strings.HasPrefix(v, regexPrefix) {
+		expr = strings.TrimPrefix(v, regexPrefix)
+	} else {
+		expr = globToRegexp(v)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, errors.Wrapf(err, "invalid pattern '%s'", v)
+	}
+	return Pattern{raw: v, regexp: re}, nil
+}
+
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// MarshalText serializes the pattern as it was provided (used by the crawl checkpoints).
+func (p Pattern) MarshalText() ([]byte, error) {
+	return []byte(p.raw), nil
+}
+
+func (p *Pattern) UnmarshalText(text []byte) error {
+	pattern, err := ParsePattern(string(text))
+	if err != nil {
+		return err
+	}
+	*p = pattern
+	return nil
+}
+
+func (p Pattern) Match(u url.URL) bool {
+	return p.regexp.MatchString(u.RequestURI())
+}
+
+func globToRegexp(glob string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// Filter decides which URLs are accepted. URL is accepted if it doesn't match any of the Exclude patterns and
+// matches one of the Include patterns (or Include is empty).
+type Filter struct {
+	Include []Pattern
+	Exclude []Pattern
+}
+
+// Parse creates the filter from the include and exclude patterns.
+func Parse(include []string, exclude []string) (Filter, error) {
+	f := Filter{}
+	for _, v := range include {
+		p, err := ParsePattern(v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.Include = append(f.Include, p)
+	}
+	for _, v := range exclude {
+		p, err := ParsePattern(v)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.Exclude = append(f.Exclude, p)
+	}
+	return f, nil
+}
+
+func (f Filter) Allow(u url.URL) bool {
+	for _, p := range f.Exclude {
+		if p.Match(u) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, p := range f.Include {
+		if p.Match(u) {
+			return true
+		}
+	}
+	return false
+}
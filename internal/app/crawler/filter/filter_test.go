@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestFilterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		url     string
+		allowed bool
+	}{
+		{"empty filter", nil, nil, "https://google.com/a", true},
+		{"glob exclude", nil, []string{"/tag/*"}, "https://google.com/tag/go/page/2", false},
+		{"glob exclude does not match", nil, []string{"/tag/*"}, "https://google.com/tags", true},
+		{"glob matches the whole path", nil, []string{"/tag"}, "https://google.com/tag/go", true},
+		{"glob matches query", nil, []string{"/search?q=*"}, "https://google.com/search?q=go", false},
+		{"glob single character", nil, []string{"/v?/*"}, "https://google.com/v1/docs", false},
+		{"glob include", []string{"/docs/*"}, nil, "https://google.com/docs/index.html", true},
+		{"glob include does not match", []string{"/docs/*"}, nil, "https://google.com/blog/", false},
+		{"regex include", []string{`re:^/(en|pl)/`}, nil, "https://google.com/pl/docs", true},
+		{"regex matches part of the path", nil, []string{`re:\.pdf$`}, "https://google.com/docs/a.pdf", false},
+		{"exclude wins", []string{"/docs/*"}, []string{"/docs/private/*"}, "https://google.com/docs/private/a", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := Parse(test.include, test.exclude)
+			if err != nil {
+				t.Fatalf("couldn't parse filter: %s", err)
+			}
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("invalid url '%s': %s", test.url, err)
+			}
+			if allowed := f.Allow(*u); allowed != test.allowed {
+				t.Errorf("Allow(%s): got: %t, want: %t", test.url, allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestParsePatternInvalidRegex(t *testing.T) {
+	if _, err := ParsePattern("re:(unclosed"); err == nil {
+		t.Errorf("invalid regular expression should be rejected")
+	}
+}
+
+func TestFilterJSON(t *testing.T) {
+	f, err := Parse([]string{"/docs/*"}, []string{`re:\.pdf$`})
+	if err != nil {
+		t.Fatalf("couldn't parse filter: %s", err)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("couldn't encode filter: %s", err)
+	}
+	var decoded Filter
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("couldn't decode filter: %s", err)
+	}
+	for _, v := range []string{"https://google.com/docs/a", "https://google.com/docs/a.pdf", "https://google.com/blog/"} {
+		u, _ := url.Parse(v)
+		if decoded.Allow(*u) != f.Allow(*u) {
+			t.Errorf("Allow(%s) of the decoded filter differs", v)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package history
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"net/url"
+)
+
+// MaxCapacity limits the expected number of URLs, the initial size of the Bloom filter and the disk table
+// is proportional to it.
+const MaxCapacity = 1000000000
+
+// History remembers the URLs which were already processed, so each URL is crawled only once.
+type History interface {
+	URLWasAlreadyProcessed(u url.URL) bool
+	SetURLProcessed(u url.URL)
+	// Len returns the number of processed URLs.
+	Len() int
+	// MemoryUsage returns the estimated number of bytes kept in the memory.
+	MemoryUsage() int
+	// Save writes the history to w, so the crawl might be resumed (format depends on the implementation).
+	Save(w io.Writer) error
+	// Load replaces the history with the one written by Save of the same implementation.
+	Load(r io.Reader) error
+}
+
+// urlHash returns the 128-bit FNV-1a hash of the URL split into two halves.
+func urlHash(u url.URL) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(u.String()))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:])
+}
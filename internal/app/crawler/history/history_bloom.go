@@ -0,0 +1,182 @@
+package history
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// bloomGrowth is the capacity ratio of the consecutive filters.
+	bloomGrowth = 2
+	// bloomTightening is the false positive rate ratio of the consecutive filters. The rates form
+	// a geometric series, so the compound rate stays below the configured one regardless of the number of filters.
+	bloomTightening = 0.5
+)
+
+// Bloom is the scalable Bloom filter (Almeida et al., "Scalable Bloom Filters"). It uses a few bytes per URL
+// regardless of the URL length, but it might report a new URL as already processed (such URL isn't crawled).
+// When the current filter is full, a new one with a doubled capacity and a tighter false positive rate
+// is added, so the compound false positive rate stays below the configured one.
+type Bloom struct {
+	falsePositiveRate float64
+	filters           []*bloomFilter
+	length            int
+}
+
+type bloomFilter struct {
+	bits []uint64
+	// size is the number of bits.
+	size   uint64
+	hashes int
+	// capacity is the number of URLs which might be added before the false positive rate is exceeded.
+	capacity int
+	count    int
+}
+
+// NewBloom creates the filter for the expected number of URLs (it grows if the capacity is exceeded)
+// with the maximum false positive rate (e.g. 0.001).
+func NewBloom(capacity int, falsePositiveRate float64) (*Bloom, error) {
+	if capacity < 1 || capacity > MaxCapacity {
+		return nil, errors.Errorf("invalid capacity %d, it must be between 1 and %d", capacity, MaxCapacity)
+	}
+	// Negated, so NaN is rejected as well.
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return nil, errors.Errorf("invalid false positive rate %v, it must be between 0 and 1", falsePositiveRate)
+	}
+	b := &Bloom{falsePositiveRate: falsePositiveRate}
+	b.filters = append(b.filters, newBloomFilter(capacity, falsePositiveRate*(1-bloomTightening)))
+	return b, nil
+}
+
+// bloomState is the saved state of the Bloom filter.
+type bloomState struct {
+	FalsePositiveRate float64
+	Filters           []bloomFilterState
+	Length            int
+}
+
+type bloomFilterState struct {
+	Bits     []uint64
+	Size     uint64
+	Hashes   int
+	Capacity int
+	Count    int
+}
+
+func newBloomFilter(capacity int, falsePositiveRate float64) *bloomFilter {
+	// Optimal number of bits and hash functions for the capacity and the false positive rate.
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if size < 64 {
+		size = 64
+	}
+	hashes := int(math.Ceil(float64(size) / float64(capacity) * math.Ln2))
+	return &bloomFilter{
+		bits:     make([]uint64, (size+63)/64),
+		size:     size,
+		hashes:   hashes,
+		capacity: capacity,
+	}
+}
+
+func (b *Bloom) URLWasAlreadyProcessed(u url.URL) bool {
+	h1, h2 := urlHash(u)
+	return b.contains(h1, h2)
+}
+
+func (b *Bloom) SetURLProcessed(u url.URL) {
+	h1, h2 := urlHash(u)
+	if b.contains(h1, h2) {
+		return
+	}
+	last := b.filters[len(b.filters)-1]
+	if last.count >= last.capacity {
+		rate := b.falsePositiveRate * (1 - bloomTightening) * math.Pow(bloomTightening, float64(len(b.filters)))
+		last = newBloomFilter(last.capacity*bloomGrowth, rate)
+		b.filters = append(b.filters, last)
+	}
+	last.add(h1, h2)
+	b.length++
+}
+
+func (b *Bloom) Len() int {
+	return b.length
+}
+
+func (b *Bloom) MemoryUsage() int {
+	memory := 0
+	for _, f := range b.filters {
+		memory += len(f.bits) * 8
+	}
+	return memory
+}
+
+func (b *Bloom) Save(w io.Writer) error {
+	state := bloomState{FalsePositiveRate: b.falsePositiveRate, Length: b.length}
+	for _, f := range b.filters {
+		state.Filters = append(state.Filters, bloomFilterState{
+			Bits:     f.bits,
+			Size:     f.size,
+			Hashes:   f.hashes,
+			Capacity: f.capacity,
+			Count:    f.count,
+		})
+	}
+	return errors.Wrap(gob.NewEncoder(w).Encode(state), "writing history")
+}
+
+func (b *Bloom) Load(r io.Reader) error {
+	var state bloomState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return errors.Wrap(err, "reading history")
+	}
+	if len(state.Filters) == 0 {
+		return errors.New("reading history: bloom filter without filters")
+	}
+	filters := make([]*bloomFilter, 0, len(state.Filters))
+	for _, f := range state.Filters {
+		if f.Size == 0 || uint64(len(f.Bits)) != (f.Size+63)/64 {
+			return errors.Errorf("reading history: invalid filter size %d", f.Size)
+		}
+		filters = append(filters, &bloomFilter{
+			bits:     f.Bits,
+			size:     f.Size,
+			hashes:   f.Hashes,
+			capacity: f.Capacity,
+			count:    f.Count,
+		})
+	}
+	b.falsePositiveRate, b.filters, b.length = state.FalsePositiveRate, filters, state.Length
+	return nil
+}
+
+func (b *Bloom) contains(h1, h2 uint64) bool {
+	for _, f := range b.filters {
+		if f.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bit positions are computed with the double hashing (Kirsch and Mitzenmacher), so the URL is hashed only once.
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+func (f *bloomFilter) contains(h1, h2 uint64) bool {
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,284 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// slotSize is the size of the table slot: 128-bit hash of the URL (zero bytes mean the empty slot).
+	slotSize = 16
+	// pageSlots is the number of slots read at once while looking for the URL.
+	pageSlots = 256
+	// minSlots is the minimum size of the table.
+	minSlots = 1024
+)
+
+var emptySlot [slotSize]byte
+
+// Disk keeps the processed URLs in the on-disk hash table, so its memory usage is constant regardless
+// of the number of URLs. The table file stores 128-bit hashes of the URLs (open addressing with linear probing)
+// and is rebuilt with a doubled size when it's half full. Hash collisions are practically impossible
+// (probability is about n^2 / 2^129 for n URLs), so the history is exact for any realistic crawl.
+type Disk struct {
+	dir   string
+	file  *os.File
+	slots uint64
+	// generation is the sequence number of the table file (incremented when the table grows).
+	generation int
+	length     int
+	page       []byte
+	err        error
+}
+
+// NewDisk creates the history storing its table in a new temporary directory inside the dir
+// (system temporary directory if dir is empty). The table is initially sized for the capacity URLs.
+// The directory is removed by Close.
+func NewDisk(dir string, capacity int) (*Disk, error) {
+	if capacity < 0 || capacity > MaxCapacity {
+		return nil, errors.Errorf("invalid capacity %d, it must be between 0 and %d", capacity, MaxCapacity)
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "creating directory '%s'", dir)
+		}
+	}
+	tableDir, err := ioutil.TempDir(dir, "history-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating table directory")
+	}
+	h := &Disk{
+		dir:   tableDir,
+		slots: minSlots,
+		page:  make([]byte, pageSlots*slotSize),
+	}
+	// Capacity is bounded, so the doubled number of slots can't overflow.
+	for needed := 2 * uint64(capacity); h.slots < needed; {
+		h.slots *= 2
+	}
+	h.file, err = h.createTable(h.generation, h.slots)
+	if err != nil {
+		os.RemoveAll(tableDir)
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Disk) URLWasAlreadyProcessed(u url.URL) bool {
+	if h.err != nil {
+		return false
+	}
+	_, found, err := h.find(h.file, h.slots, key(u))
+	if err != nil {
+		h.setErr(err)
+		return false
+	}
+	return found
+}
+
+func (h *Disk) SetURLProcessed(u url.URL) {
+	if h.err != nil {
+		return
+	}
+	if uint64(h.length+1) > h.slots/2 {
+		if err := h.grow(); err != nil {
+			h.setErr(err)
+			return
+		}
+	}
+	k := key(u)
+	added, err := h.insert(h.file, h.slots, k)
+	if err != nil {
+		h.setErr(err)
+		return
+	}
+	if added {
+		h.length++
+	}
+}
+
+func (h *Disk) Len() int {
+	return h.length
+}
+
+func (h *Disk) MemoryUsage() int {
+	return len(h.page)
+}
+
+// Save writes the table size, the number of URLs and the table itself.
+func (h *Disk) Save(w io.Writer) error {
+	if h.err != nil {
+		return h.err
+	}
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint64(header[:8], h.slots)
+	binary.BigEndian.PutUint64(header[8:], uint64(h.length))
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, "writing history")
+	}
+	_, err := io.Copy(w, io.NewSectionReader(h.file, 0, int64(h.slots*slotSize)))
+	return errors.Wrap(err, "writing history")
+}
+
+// Load copies the saved table to a new table file.
+func (h *Disk) Load(r io.Reader) error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return errors.Wrap(err, "reading history")
+	}
+	slots, length := binary.BigEndian.Uint64(header[:8]), int(binary.BigEndian.Uint64(header[8:]))
+	if slots < minSlots || slots&(slots-1) != 0 || uint64(length) > slots/2 {
+		return errors.Errorf("reading history: invalid table of %d slots with %d urls", slots, length)
+	}
+	file, err := h.createTable(h.generation+1, slots)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(file, r, int64(slots*slotSize)); err != nil {
+		file.Close()
+		os.Remove(h.tableName(h.generation + 1))
+		return errors.Wrap(err, "reading history")
+	}
+	h.replaceTable(file, slots)
+	h.length = length
+	return nil
+}
+
+// Err returns the first error of the disk operation. History doesn't remember any URL after the error,
+// so the URLs might be crawled more than once.
+func (h *Disk) Err() error {
+	return h.err
+}
+
+// Close removes the table file.
+func (h *Disk) Close() error {
+	h.file.Close()
+	return errors.Wrap(os.RemoveAll(h.dir), "removing table directory")
+}
+
+func (h *Disk) setErr(err error) {
+	if h.err == nil {
+		h.err = err
+	}
+}
+
+func (h *Disk) tableName(generation int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("table-%08d", generation))
+}
+
+func (h *Disk) createTable(generation int, slots uint64) (*os.File, error) {
+	name := h.tableName(generation)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating table '%s'", name)
+	}
+	// Table file is sparse, so the empty slots don't use the disk space.
+	if err := f.Truncate(int64(slots * slotSize)); err != nil {
+		f.Close()
+		os.Remove(name)
+		return nil, errors.Wrapf(err, "resizing table '%s'", name)
+	}
+	return f, nil
+}
+
+// grow rewrites all hashes to a new table of a doubled size.
+func (h *Disk) grow() error {
+	slots := h.slots * 2
+	file, err := h.createTable(h.generation+1, slots)
+	if err != nil {
+		return err
+	}
+	if err := h.copyTable(file, slots); err != nil {
+		file.Close()
+		os.Remove(h.tableName(h.generation + 1))
+		return err
+	}
+	h.replaceTable(file, slots)
+	return nil
+}
+
+// replaceTable switches to the table file of the next generation and removes the current one.
+func (h *Disk) replaceTable(file *os.File, slots uint64) {
+	h.file.Close()
+	if err := os.Remove(h.tableName(h.generation)); err != nil {
+		h.setErr(errors.Wrapf(err, "removing table '%s'", h.tableName(h.generation)))
+	}
+	h.file, h.slots = file, slots
+	h.generation++
+}
+
+func (h *Disk) copyTable(file *os.File, slots uint64) error {
+	r := bufio.NewReader(io.NewSectionReader(h.file, 0, int64(h.slots*slotSize)))
+	var k [slotSize]byte
+	for i := uint64(0); i < h.slots; i++ {
+		if _, err := io.ReadFull(r, k[:]); err != nil {
+			return errors.Wrapf(err, "reading table '%s'", h.tableName(h.generation))
+		}
+		if k == emptySlot {
+			continue
+		}
+		if _, err := h.insert(file, slots, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert writes the hash to the table. It returns false if the hash was already there.
+func (h *Disk) insert(file *os.File, slots uint64, k [slotSize]byte) (bool, error) {
+	index, found, err := h.find(file, slots, k)
+	if err != nil || found {
+		return false, err
+	}
+	if _, err := file.WriteAt(k[:], int64(index*slotSize)); err != nil {
+		return false, errors.Wrapf(err, "writing table '%s'", file.Name())
+	}
+	return true, nil
+}
+
+// find returns the index of the slot with the hash or (if the hash isn't in the table) the index
+// of the empty slot where it belongs. Table is at most half full, so the empty slot always exists.
+func (h *Disk) find(file *os.File, slots uint64, k [slotSize]byte) (uint64, bool, error) {
+	index := binary.BigEndian.Uint64(k[:8]) & (slots - 1)
+	for {
+		n := slots - index
+		if n > pageSlots {
+			n = pageSlots
+		}
+		page := h.page[:n*slotSize]
+		if _, err := file.ReadAt(page, int64(index*slotSize)); err != nil {
+			return 0, false, errors.Wrapf(err, "reading table '%s'", file.Name())
+		}
+		for i := uint64(0); i < n; i++ {
+			slot := page[i*slotSize : (i+1)*slotSize]
+			if bytes.Equal(slot, k[:]) {
+				return index + i, true, nil
+			}
+			if bytes.Equal(slot, emptySlot[:]) {
+				return index + i, false, nil
+			}
+		}
+		index = (index + n) & (slots - 1)
+	}
+}
+
+// key returns the hash of the URL stored in the table (it's never equal to the empty slot).
+func key(u url.URL) [slotSize]byte {
+	var k [slotSize]byte
+	h1, h2 := urlHash(u)
+	binary.BigEndian.PutUint64(k[:8], h1)
+	binary.BigEndian.PutUint64(k[8:], h2)
+	if k == emptySlot {
+		k[slotSize-1] = 1
+	}
+	return k
+}
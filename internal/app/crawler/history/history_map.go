@@ -0,0 +1,75 @@
+package history
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// maxLineLength is the maximum length of the saved URL (URLs are rarely longer than a few KB).
+const maxLineLength = 1024 * 1024
+
+// mapEntryOverhead is the estimated memory used by a single map entry besides the URL bytes
+// (string header, hash bucket slot and the map's load factor).
+const mapEntryOverhead = 48
+
+// Map keeps all processed URLs in the memory. It's exact and the fastest, but its memory usage grows
+// with the length of the URLs.
+type Map struct {
+	processedURLs map[string]struct{}
+	memory        int
+}
+
+func NewMap() *Map {
+	return &Map{
+		processedURLs: make(map[string]struct{}),
+	}
+}
+
+func (h *Map) URLWasAlreadyProcessed(u url.URL) bool {
+	_, alreadyProcessed := h.processedURLs[u.String()]
+	return alreadyProcessed
+}
+
+func (h *Map) SetURLProcessed(u url.URL) {
+	key := u.String()
+	if _, ok := h.processedURLs[key]; ok {
+		return
+	}
+	h.processedURLs[key] = struct{}{}
+	h.memory += len(key) + mapEntryOverhead
+}
+
+func (h *Map) Len() int {
+	return len(h.processedURLs)
+}
+
+func (h *Map) MemoryUsage() int {
+	return h.memory
+}
+
+// Save writes the URLs one per line.
+func (h *Map) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for key := range h.processedURLs {
+		if _, err := bw.WriteString(key + "\n"); err != nil {
+			return errors.Wrap(err, "writing history")
+		}
+	}
+	return errors.Wrap(bw.Flush(), "writing history")
+}
+
+func (h *Map) Load(r io.Reader) error {
+	h.processedURLs = make(map[string]struct{})
+	h.memory = 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		key := scanner.Text()
+		h.processedURLs[key] = struct{}{}
+		h.memory += len(key) + mapEntryOverhead
+	}
+	return errors.Wrap(scanner.Err(), "reading history")
+}
@@ -0,0 +1,174 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func testURL(i int) url.URL {
+	u, _ := url.Parse(fmt.Sprintf("https://google.com/page/%d?q=a%%20b", i))
+	return *u
+}
+
+// testHistory checks that the history remembers all processed URLs and reports at most maxFalsePositives
+// of the new URLs as processed.
+func testHistory(t *testing.T, h History, count int, maxFalsePositives int) {
+	for i := 0; i < count; i++ {
+		h.SetURLProcessed(testURL(i))
+		// URLs are set more than once (e.g. seeds listed in the sitemap).
+		h.SetURLProcessed(testURL(i / 2))
+	}
+	// False positives of the Bloom filter are skipped while adding the URLs.
+	if h.Len() > count || h.Len() < count-maxFalsePositives {
+		t.Errorf("invalid length: got: %d, want: %d", h.Len(), count)
+	}
+	for i := 0; i < count; i++ {
+		if u := testURL(i); !h.URLWasAlreadyProcessed(u) {
+			t.Fatalf("url '%s' should be processed", u.String())
+		}
+	}
+	falsePositives := 0
+	for i := count; i < 2*count; i++ {
+		if h.URLWasAlreadyProcessed(testURL(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > maxFalsePositives {
+		t.Errorf("too many false positives: got: %d, want at most: %d", falsePositives, maxFalsePositives)
+	}
+	if h.MemoryUsage() <= 0 {
+		t.Errorf("memory usage should be positive, got: %d", h.MemoryUsage())
+	}
+}
+
+func TestMap(t *testing.T) {
+	testHistory(t, NewMap(), 1000, 0)
+}
+
+func TestBloom(t *testing.T) {
+	// Filter grows a few times, but the compound false positive rate stays around 1% (with some margin
+	// for the randomness).
+	h, err := NewBloom(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHistory(t, h, 20000, 300)
+	if len(h.filters) < 3 {
+		t.Errorf("filter should grow, got %d filters", len(h.filters))
+	}
+	// 1% false positive rate needs about 10 bits per URL (map needs ~100 bytes per URL).
+	if h.MemoryUsage() > 20000*4 {
+		t.Errorf("bloom filter should use a few bytes per URL, got: %d bytes", h.MemoryUsage())
+	}
+}
+
+func TestBloomInvalidOptions(t *testing.T) {
+	if _, err := NewBloom(0, 0.01); err == nil {
+		t.Error("capacity must be positive")
+	}
+	if _, err := NewBloom(MaxCapacity+1, 0.01); err == nil {
+		t.Error("capacity must be limited")
+	}
+	for _, rate := range []float64{0, 1, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := NewBloom(100, rate); err == nil {
+			t.Errorf("false positive rate %v should be rejected", rate)
+		}
+	}
+}
+
+func TestDiskInvalidCapacity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, capacity := range []int{-1, MaxCapacity + 1} {
+		if _, err := NewDisk(dir, capacity); err == nil {
+			t.Errorf("capacity %d should be rejected", capacity)
+		}
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := NewDisk(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Table grows from 1024 slots to 4096 slots.
+	testHistory(t, h, 2000, 0)
+	if h.Err() != nil {
+		t.Fatalf("unexpected error: %s", h.Err())
+	}
+	if h.generation != 2 || h.slots != 4096 {
+		t.Errorf("table should grow twice, got: generation %d, %d slots", h.generation, h.slots)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("table directory should be removed, got %d files", len(files))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newHistories := map[string]func() History{
+		"map": func() History {
+			return NewMap()
+		},
+		"bloom": func() History {
+			h, _ := NewBloom(100, 0.001)
+			return h
+		},
+		"disk": func() History {
+			h, _ := NewDisk(dir, 1)
+			return h
+		},
+	}
+	for name, newHistory := range newHistories {
+		t.Run(name, func(t *testing.T) {
+			saved := newHistory()
+			for i := 0; i < 1000; i++ {
+				saved.SetURLProcessed(testURL(i))
+			}
+			var buf bytes.Buffer
+			if err := saved.Save(&buf); err != nil {
+				t.Fatalf("couldn't save history: %s", err)
+			}
+			loaded := newHistory()
+			loaded.SetURLProcessed(testURL(5000))
+			if err := loaded.Load(&buf); err != nil {
+				t.Fatalf("couldn't load history: %s", err)
+			}
+			if loaded.Len() != saved.Len() {
+				t.Errorf("invalid length: got: %d, want: %d", loaded.Len(), saved.Len())
+			}
+			for i := 0; i < 1000; i++ {
+				if u := testURL(i); !loaded.URLWasAlreadyProcessed(u) {
+					t.Fatalf("url '%s' should be processed", u.String())
+				}
+			}
+			if loaded.URLWasAlreadyProcessed(testURL(5000)) {
+				t.Errorf("loaded history should replace the previous one")
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package http
+
+// Validators identify the version of the page fetched by the previous crawl. Fetcher sends them in the conditional
+// request (If-None-Match, If-Modified-Since), so the server might respond with 304 Not Modified instead of the page.
+type Validators struct {
+	// ETag is the value of the ETag header.
+	ETag string
+	// LastModified is the value of the Last-Modified header.
+	LastModified string
+}
+
+func (v Validators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
@@ -3,16 +3,59 @@ package http
 import (
 	"context"
 	"errors"
+	"net/http"
 	"net/url"
+	"time"
 )
 
-var ErrInvalidStatusCode = errors.New("invalid status code")
+var (
+	ErrInvalidStatusCode = errors.New("invalid status code")
+	// ErrRequestTimeout means that the single request exceeded its timeout (while the crawl itself still runs).
+	ErrRequestTimeout = errors.New("request timed out")
+)
+
+// Response contains everything we know about the fetched site.
+type Response struct {
+	Body       []byte
+	StatusCode int
+	Header     http.Header
+	// URL is the URL of the response. It might differ from the requested one if fetcher followed redirects.
+	URL url.URL
+	// ContentLength is the value of Content-Length header (-1 if unknown).
+	ContentLength int64
+	// Duration is the time between sending the request and reading the whole body.
+	Duration time.Duration
+	// Protocol is the protocol used by the server (e.g. 'HTTP/1.1', 'HTTP/2.0').
+	Protocol string
+}
+
+// DefaultMaxBodySize limits the body of the fetched page (longer bodies are truncated).
+const DefaultMaxBodySize = 10 * 1024 * 1024
+
+// FetchOptions configure the single request.
+type FetchOptions struct {
+	// MaxBodySize limits the body read from the response (0 means DefaultMaxBodySize).
+	MaxBodySize int64
+	// Validators make the request conditional (zero value means the unconditional request).
+	Validators Validators
+}
+
+// BodyLimit returns the maximum size of the response body.
+func (o FetchOptions) BodyLimit() int64 {
+	if o.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return o.MaxBodySize
+}
 
 // Fetcher provides functionality of fetching and rendering the contents of web sites.
 // In the simple approach it might be just the HTTP client. However, you could also provide here an implementation that
 // uses full headless web browser for rendering sites (especially modern ones).
+//
+// If the server responded with the status code other than 200, Fetch returns the response (without the body) along
+// with the ErrInvalidStatusCode. Response is nil only if the request failed.
 type Fetcher interface {
-	Fetch(ctx context.Context, url url.URL) ([]byte, int, error)
+	Fetch(ctx context.Context, url url.URL, options FetchOptions) (*Response, error)
 }
 
 type FetcherCreator = func() Fetcher
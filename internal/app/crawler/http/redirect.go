@@ -0,0 +1,15 @@
+package http
+
+import "net/http"
+
+// IsRedirect checks if the status code means that the resource is available at the different location.
+// Fetcher doesn't follow redirects, so the Manager could decide if the target is in scope of the crawl.
+func IsRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
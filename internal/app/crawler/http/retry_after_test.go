@@ -0,0 +1,32 @@
+package http
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"seconds with spaces", " 5 ", 5 * time.Second, true},
+		{"negative seconds", "-1", 0, false},
+		{"date", "Wed, 01 May 2019 12:01:30 GMT", 90 * time.Second, true},
+		{"date in the past", "Wed, 01 May 2019 11:00:00 GMT", 0, true},
+		{"invalid", "soon", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay, ok := ParseRetryAfter(test.value, now)
+			if delay != test.delay || ok != test.ok {
+				t.Errorf("ParseRetryAfter(%q): got: %s, %t, want: %s, %t", test.value, delay, ok, test.delay, test.ok)
+			}
+		})
+	}
+}
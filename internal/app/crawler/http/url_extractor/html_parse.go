@@ -8,13 +8,26 @@ import (
 	"golang.org/x/net/html"
 )
 
-type HTMLParse struct{}
+type HTMLParse struct {
+	normalization NormalizationPolicy
+}
 
-func NewHTMLParse() *HTMLParse {
-	return &HTMLParse{}
+func NewHTMLParse(normalization NormalizationPolicy) *HTMLParse {
+	return &HTMLParse{
+		normalization: normalization,
+	}
 }
 
 func (uer *HTMLParse) ExtractURLs(baseURL url.URL, body []byte) ([]url.URL, error) {
+	page, err := uer.ExtractPage(baseURL, body)
+	if err != nil {
+		return nil, err
+	}
+	return page.URLs, nil
+}
+
+// ExtractPage extracts the URLs along with the page metadata.
+func (uer *HTMLParse) ExtractPage(baseURL url.URL, body []byte) (*Page, error) {
 	root, err := html.Parse(bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrap(err, "parsing body")
@@ -24,7 +37,22 @@ func (uer *HTMLParse) ExtractURLs(baseURL url.URL, body []byte) ([]url.URL, erro
 	resolvedURLs := uer.resolveURLs(baseURL, urls)
 	urls = uer.normalizeURLs(resolvedURLs)
 
-	return urls, nil
+	return &Page{
+		URLs:         urls,
+		Title:        uer.extractTitle(root),
+		Alternates:   uer.extractAlternates(baseURL, root),
+		Canonical:    uer.extractCanonical(baseURL, root),
+		ModifiedTime: uer.extractModifiedTime(root),
+	}, nil
+}
+
+// ResolveURL resolves the (possibly relative) rawURL against the baseURL and normalizes it.
+func (uer *HTMLParse) ResolveURL(baseURL url.URL, rawURL string) (url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return url.URL{}, errors.Wrap(err, "parsing url")
+	}
+	return uer.normalization.Normalize(*baseURL.ResolveReference(u)), nil
 }
 
 func (uer *HTMLParse) extractURLsFromAHrefs(root *html.Node) []url.URL {
@@ -62,7 +90,7 @@ func (uer *HTMLParse) resolveURLs(base url.URL, links []url.URL) []url.URL {
 func (uer *HTMLParse) normalizeURLs(urls []url.URL) []url.URL {
 	normalizedURLs := make([]url.URL, 0, len(urls))
 	for _, u := range urls {
-		normalizedURLs = append(normalizedURLs, normalizeURL(u))
+		normalizedURLs = append(normalizedURLs, uer.normalization.Normalize(u))
 	}
 	return normalizedURLs
 }
@@ -3,6 +3,7 @@ package url_extractor
 import (
 	"net/url"
 	"testing"
+	"time"
 )
 
 const siteWithValidHTML = `<html>
@@ -16,7 +17,7 @@ const siteWithValidHTML = `<html>
 `
 
 func TestURLExtractor(t *testing.T) {
-	urlExtractor := NewHTMLParse()
+	urlExtractor := NewHTMLParse(DefaultNormalizationPolicy())
 
 	u, _ := url.Parse("https://bing.com/v1/")
 	urls, err := urlExtractor.ExtractURLs(*u, []byte(siteWithValidHTML))
@@ -38,3 +39,102 @@ func TestURLExtractor(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractPageModifiedTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "no metadata",
+			html:     `<html><head><title>Test</title></head></html>`,
+			expected: "0001-01-01T00:00:00Z",
+		},
+		{
+			name:     "meta article:modified_time",
+			html:     `<html><head><meta property="article:modified_time" content="2019-07-01T10:00:00+02:00"></head></html>`,
+			expected: "2019-07-01T10:00:00+02:00",
+		},
+		{
+			name: "JSON-LD dateModified in graph",
+			html: `<html><head><script type="application/ld+json">
+				{"@context": "https://schema.org", "@graph": [{"@type": "WebPage", "dateModified": "2019-07-02"}]}
+			</script></head></html>`,
+			expected: "2019-07-02T00:00:00Z",
+		},
+		{
+			name: "meta has priority over JSON-LD",
+			html: `<html><head>
+				<script type="application/ld+json">{"dateModified": "2019-07-02T00:00:00Z"}</script>
+				<meta property="article:modified_time" content="2019-07-03T00:00:00Z">
+			</head></html>`,
+			expected: "2019-07-03T00:00:00Z",
+		},
+	}
+
+	urlExtractor := NewHTMLParse(DefaultNormalizationPolicy())
+	u, _ := url.Parse("https://bing.com/")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := urlExtractor.ExtractPage(*u, []byte(test.html))
+			if err != nil {
+				t.Fatalf("extracting page err: %s", err)
+			}
+			if got := page.ModifiedTime.Format(time.RFC3339); got != test.expected {
+				t.Errorf("invalid modified time, got: %s, expected: %s", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestExtractPageTitle(t *testing.T) {
+	html := `<html><head><title>
+		Awesome   page
+	</title></head><body><svg><title>Icon</title></svg></body></html>`
+
+	urlExtractor := NewHTMLParse(DefaultNormalizationPolicy())
+	u, _ := url.Parse("https://bing.com/")
+	page, err := urlExtractor.ExtractPage(*u, []byte(html))
+	if err != nil {
+		t.Fatalf("extracting page err: %s", err)
+	}
+	if page.Title != "Awesome page" {
+		t.Errorf("invalid title, got: %q, expected: %q", page.Title, "Awesome page")
+	}
+}
+
+func TestExtractPageAlternates(t *testing.T) {
+	html := `<html><head>
+		<link rel="alternate" hreflang="en" href="/en/">
+		<link rel="alternate" hreflang="de-CH" href="https://bing.com/de/#top">
+		<link rel="alternate" type="application/rss+xml" href="/feed">
+	</head></html>`
+
+	urlExtractor := NewHTMLParse(DefaultNormalizationPolicy())
+	u, _ := url.Parse("https://bing.com/")
+	page, err := urlExtractor.ExtractPage(*u, []byte(html))
+	if err != nil {
+		t.Fatalf("extracting page err: %s", err)
+	}
+	expected := []Alternate{
+		{Language: "en", URL: *mustParse("https://bing.com/en/")},
+		{Language: "de-ch", URL: *mustParse("https://bing.com/de/")},
+	}
+	if len(page.Alternates) != len(expected) {
+		t.Fatalf("invalid number of alternates, got: %d, expected: %d", len(page.Alternates), len(expected))
+	}
+	for i, alternate := range page.Alternates {
+		if alternate.Language != expected[i].Language || alternate.URL.String() != expected[i].URL.String() {
+			t.Errorf("got: %v, expected: %v", alternate, expected[i])
+		}
+	}
+}
+
+func mustParse(v string) *url.URL {
+	u, err := url.Parse(v)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
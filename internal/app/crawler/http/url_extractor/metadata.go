@@ -0,0 +1,185 @@
+package url_extractor
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Layouts of dates used in the metadata. Sites usually follow the ISO 8601, but not always in the full form.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// extractModifiedTime looks for the modification time in <meta property="article:modified_time"> and
+// JSON-LD 'dateModified' (in this order).
+func (uer *HTMLParse) extractModifiedTime(root *html.Node) time.Time {
+	var metaTime, jsonLDTime time.Time
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "meta" && attr(n, "property") == "article:modified_time" && metaTime.IsZero():
+				metaTime = parseDate(attr(n, "content"))
+			case n.Data == "script" && attr(n, "type") == "application/ld+json" && jsonLDTime.IsZero():
+				if n.FirstChild != nil {
+					jsonLDTime = parseJSONLDDateModified(n.FirstChild.Data)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	if !metaTime.IsZero() {
+		return metaTime
+	}
+	return jsonLDTime
+}
+
+// extractTitle returns the text of the first <title> element (with collapsed whitespaces).
+func (uer *HTMLParse) extractTitle(root *html.Node) string {
+	var title *html.Node
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if title != nil {
+			return
+		}
+		// SVG might contain its own <title> elements.
+		if n.Type == html.ElementNode && n.Data == "svg" {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "title" {
+			title = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	if title == nil {
+		return ""
+	}
+	var text strings.Builder
+	for c := title.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			text.WriteString(c.Data)
+		}
+	}
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// extractAlternates returns the language versions of the page declared with <link rel="alternate" hreflang="...">.
+func (uer *HTMLParse) extractAlternates(baseURL url.URL, root *html.Node) []Alternate {
+	alternates := make([]Alternate, 0)
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "link" && hasRel(n, "alternate") {
+			language := strings.ToLower(attr(n, "hreflang"))
+			if language != "" {
+				if u, err := uer.ResolveURL(baseURL, attr(n, "href")); err == nil {
+					alternates = append(alternates, Alternate{Language: language, URL: u})
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	return alternates
+}
+
+// extractCanonical returns the URL declared with the first <link rel="canonical">.
+func (uer *HTMLParse) extractCanonical(baseURL url.URL, root *html.Node) *url.URL {
+	var canonical *url.URL
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if canonical != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "link" && hasRel(n, "canonical") {
+			if href := attr(n, "href"); href != "" {
+				if u, err := uer.ResolveURL(baseURL, href); err == nil {
+					canonical = &u
+					return
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	return canonical
+}
+
+func parseJSONLDDateModified(data string) time.Time {
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return time.Time{}
+	}
+	// 'dateModified' might be nested (e.g. in '@graph'), so we look for the first occurrence.
+	var find func(v interface{}) time.Time
+	find = func(v interface{}) time.Time {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if date, ok := v["dateModified"].(string); ok {
+				if t := parseDate(date); !t.IsZero() {
+					return t
+				}
+			}
+			for _, child := range v {
+				if t := find(child); !t.IsZero() {
+					return t
+				}
+			}
+		case []interface{}:
+			for _, child := range v {
+				if t := find(child); !t.IsZero() {
+					return t
+				}
+			}
+		}
+		return time.Time{}
+	}
+	return find(v)
+}
+
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// hasRel checks if the space-separated 'rel' attribute contains the value.
+func hasRel(n *html.Node, value string) bool {
+	for _, rel := range strings.Fields(attr(n, "rel")) {
+		if strings.EqualFold(rel, value) {
+			return true
+		}
+	}
+	return false
+}
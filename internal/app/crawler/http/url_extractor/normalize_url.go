@@ -1,14 +1,316 @@
 package url_extractor
 
 import (
+	"net"
 	"net/url"
+	"sort"
 	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
 )
 
-func normalizeURL(u url.URL) url.URL {
+// TrackingParams are the well-known GET params used for tracking users and sessions. They don't change the content
+// of the page, so keeping them would produce many duplicates in the sitemap. Entries ending with '*' match prefixes.
+var TrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"jsessionid",
+	"phpsessid",
+	"sid",
+}
+
+// sessionPathParams are the session IDs which might be embedded in the path (e.g. '/page;jsessionid=123').
+var sessionPathParams = []string{
+	"jsessionid",
+	"phpsessid",
+}
+
+// defaultPorts are removed from the URLs (RFC 3986, 6.2.3).
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// TrailingSlash decides what to do with the trailing slash of the path. Sites usually serve the same content
+// for '/about' and '/about/', but it's not guaranteed, so by default we keep the path as it is.
+type TrailingSlash string
+
+const (
+	TrailingSlashKeep TrailingSlash = ""
+	// TrailingSlashAdd adds the trailing slash to the paths which don't look like files (no '.' in last segment).
+	TrailingSlashAdd TrailingSlash = "add"
+	// TrailingSlashRemove removes the trailing slash (except the root path).
+	TrailingSlashRemove TrailingSlash = "remove"
+)
+
+func ParseTrailingSlash(v string) (TrailingSlash, error) {
+	switch t := TrailingSlash(v); t {
+	case TrailingSlashKeep, TrailingSlashAdd, TrailingSlashRemove:
+		return t, nil
+	case "keep":
+		return TrailingSlashKeep, nil
+	default:
+		return "", errors.Errorf("unsupported trailing slash policy '%s'", v)
+	}
+}
+
+// NormalizationPolicy decides how the URLs are normalized, in particular which GET params are kept.
+// Explicitly denied params are always removed, explicitly allowed params are kept even if they are on the
+// TrackingParams list.
+type NormalizationPolicy struct {
+	// StripTrackingParams removes the TrackingParams and session IDs embedded in the path.
+	StripTrackingParams bool
+	// AllowedParams is the list of params to keep. If it's not empty, all other params are removed.
+	AllowedParams []string
+	// DeniedParams is the list of params to remove.
+	DeniedParams []string
+	// SortParams sorts the params by name, so the order of params doesn't produce duplicates.
+	SortParams bool
+	// TrailingSlash decides what to do with the trailing slash of the path.
+	TrailingSlash TrailingSlash
+}
+
+func DefaultNormalizationPolicy() NormalizationPolicy {
+	return NormalizationPolicy{
+		StripTrackingParams: true,
+	}
+}
+
+// SplitList splits the comma separated list (e.g. AllowedParams provided by the user), empty items are skipped.
+func SplitList(v string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Normalize transforms the URL into its normalized form (RFC 3986, section 6), so the same page is always
+// represented by the same URL:
+//   - scheme and host are lowercase, IDN hosts are converted to punycode, default port is removed,
+//   - dot segments and duplicated slashes are removed from the path, empty path is replaced by '/',
+//   - percent-encoded unreserved characters are decoded, other percent-encodings are uppercase,
+//   - fragment is removed and the GET params are filtered according to the policy.
+func (p NormalizationPolicy) Normalize(u url.URL) url.URL {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = normalizeHost(u.Scheme, u.Host)
 	u.Fragment = ""
-	u.Path = strings.Replace(u.Path, "//", "/", -1)
-	u.RawPath = strings.Replace(u.RawPath, "//", "/", -1)
 	u.ForceQuery = false
+
+	path := normalizePercentEncoding(u.EscapedPath())
+	for strings.Contains(path, "//") {
+		path = strings.Replace(path, "//", "/", -1)
+	}
+	path = removeDotSegments(path)
+	if p.StripTrackingParams {
+		path = removeSessionPathParams(path)
+	}
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	path = p.applyTrailingSlash(path)
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		u.Path = unescaped
+		u.RawPath = path
+	}
+
+	u.RawQuery = normalizePercentEncoding(p.normalizeQuery(u.RawQuery))
 	return u
 }
+
+func (p NormalizationPolicy) applyTrailingSlash(path string) string {
+	switch p.TrailingSlash {
+	case TrailingSlashAdd:
+		lastSegment := path[strings.LastIndex(path, "/")+1:]
+		if !strings.HasSuffix(path, "/") && !strings.Contains(lastSegment, ".") {
+			return path + "/"
+		}
+	case TrailingSlashRemove:
+		if path != "/" && strings.HasSuffix(path, "/") {
+			return strings.TrimRight(path, "/")
+		}
+	}
+	return path
+}
+
+func normalizeHost(scheme, host string) string {
+	if host == "" {
+		return host
+	}
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(hostname)
+	if ascii, err := idna.Lookup.ToASCII(hostname); err == nil {
+		hostname = ascii
+	}
+	if strings.Contains(hostname, ":") {
+		// IPv6 address.
+		hostname = "[" + strings.Trim(hostname, "[]") + "]"
+	}
+	if port == "" || defaultPorts[scheme] == port {
+		return hostname
+	}
+	return hostname + ":" + port
+}
+
+// normalizePercentEncoding decodes the percent-encoded unreserved characters (RFC 3986, 2.3) and uppercases
+// hexadecimal digits of other percent-encodings (RFC 3986, 6.2.2.1).
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteByte('%')
+			buf.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return buf.String()
+}
+
+// removeDotSegments removes '.' and '..' segments from the path (RFC 3986, 5.2.4).
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			// The first (empty) segment is the root of the absolute path.
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+		default:
+			output = append(output, segment)
+			continue
+		}
+		if last {
+			output = append(output, "")
+		}
+	}
+	return strings.Join(output, "/")
+}
+
+func isUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func (p NormalizationPolicy) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	type param struct {
+		name string
+		raw  string
+	}
+	params := make([]param, 0)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name := raw
+		if i := strings.Index(raw, "="); i >= 0 {
+			name = raw[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !p.keepParam(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+	if p.SortParams {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+	raws := make([]string, 0, len(params))
+	for _, param := range params {
+		raws = append(raws, param.raw)
+	}
+	return strings.Join(raws, "&")
+}
+
+func (p NormalizationPolicy) keepParam(name string) bool {
+	if matchParam(p.DeniedParams, name) {
+		return false
+	}
+	if len(p.AllowedParams) > 0 {
+		return matchParam(p.AllowedParams, name)
+	}
+	return !p.StripTrackingParams || !matchParam(TrackingParams, name)
+}
+
+// matchParam checks if the param name is on the list (case insensitive, '*' at the end matches any suffix).
+func matchParam(list []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range list {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+			continue
+		}
+		if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSessionPathParams removes the session IDs embedded in the path segments, e.g. '/page;jsessionid=123'.
+func removeSessionPathParams(path string) string {
+	if !strings.Contains(path, ";") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		parts := strings.Split(segment, ";")
+		kept := parts[:1]
+		for _, part := range parts[1:] {
+			name := strings.SplitN(part, "=", 2)[0]
+			if !matchParam(sessionPathParams, name) {
+				kept = append(kept, part)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+	return strings.Join(segments, "/")
+}
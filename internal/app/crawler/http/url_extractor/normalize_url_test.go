@@ -0,0 +1,216 @@
+package url_extractor
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizationPolicyParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   NormalizationPolicy
+		url      string
+		expected string
+	}{
+		{
+			name:     "tracking params are removed",
+			policy:   DefaultNormalizationPolicy(),
+			url:      "https://google.com/?utm_source=fb&p=2&fbclid=abc&UTM_Medium=x&gclid=1",
+			expected: "https://google.com/?p=2",
+		},
+		{
+			name:     "session ids are removed from query and path",
+			policy:   DefaultNormalizationPolicy(),
+			url:      "https://google.com/page;jsessionid=ABC123?PHPSESSID=1&sid=2&q=test",
+			expected: "https://google.com/page?q=test",
+		},
+		{
+			name:     "tracking params are kept if stripping is disabled",
+			policy:   NormalizationPolicy{},
+			url:      "https://google.com/page;jsessionid=ABC?utm_source=fb",
+			expected: "https://google.com/page;jsessionid=ABC?utm_source=fb",
+		},
+		{
+			name: "only allowed params are kept",
+			policy: NormalizationPolicy{
+				StripTrackingParams: true,
+				AllowedParams:       []string{"q", "sid"},
+			},
+			url:      "https://google.com/?q=1&sid=2&lang=en",
+			expected: "https://google.com/?q=1&sid=2",
+		},
+		{
+			name: "denied params are removed",
+			policy: NormalizationPolicy{
+				StripTrackingParams: true,
+				DeniedParams:        []string{"sort", "ref_*"},
+			},
+			url:      "https://google.com/?sort=asc&ref_id=1&ref=2",
+			expected: "https://google.com/?ref=2",
+		},
+		{
+			name: "params are sorted",
+			policy: NormalizationPolicy{
+				SortParams: true,
+			},
+			url:      "https://google.com/?b=2&a=1&c=3&a=0",
+			expected: "https://google.com/?a=1&a=0&b=2&c=3",
+		},
+		{
+			name:     "empty query is removed",
+			policy:   DefaultNormalizationPolicy(),
+			url:      "https://google.com/?utm_source=fb",
+			expected: "https://google.com/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("invalid url '%s': %s", test.url, err)
+			}
+			normalized := test.policy.Normalize(*u)
+			if normalized.String() != test.expected {
+				t.Errorf("got: %s, expected: %s", normalized.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizationPolicyRFC3986(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   NormalizationPolicy
+		url      string
+		expected string
+	}{
+		{
+			name:     "equivalent urls",
+			url:      "HTTP://Example.com:80/a/./b/%7euser",
+			expected: "http://example.com/a/b/~user",
+		},
+		{
+			name:     "default https port is removed",
+			url:      "https://google.com:443/a",
+			expected: "https://google.com/a",
+		},
+		{
+			name:     "other ports are kept",
+			url:      "https://google.com:8443/a",
+			expected: "https://google.com:8443/a",
+		},
+		{
+			name:     "empty path",
+			url:      "https://google.com",
+			expected: "https://google.com/",
+		},
+		{
+			name:     "empty path with query",
+			url:      "https://google.com?q=1",
+			expected: "https://google.com/?q=1",
+		},
+		{
+			name:     "dot segments",
+			url:      "https://google.com/a/b/../c/./d",
+			expected: "https://google.com/a/c/d",
+		},
+		{
+			name:     "dot segments at the end",
+			url:      "https://google.com/a/b/..",
+			expected: "https://google.com/a/",
+		},
+		{
+			name:     "dot segments above root",
+			url:      "https://google.com/../../a",
+			expected: "https://google.com/a",
+		},
+		{
+			name:     "duplicated slashes",
+			url:      "https://google.com//a///b",
+			expected: "https://google.com/a/b",
+		},
+		{
+			name:     "percent-encoding is uppercase",
+			url:      "https://google.com/a%2fb?q=%c3%b3",
+			expected: "https://google.com/a%2Fb?q=%C3%B3",
+		},
+		{
+			name:     "unreserved characters are decoded",
+			url:      "https://google.com/%41%2D%5f?q=%7E",
+			expected: "https://google.com/A-_?q=~",
+		},
+		{
+			name:     "idn host",
+			url:      "https://Bücher.example/a",
+			expected: "https://xn--bcher-kva.example/a",
+		},
+		{
+			name:     "ipv6 host",
+			url:      "http://[::1]:80/a",
+			expected: "http://[::1]/a",
+		},
+		{
+			name:     "fragment",
+			url:      "https://google.com/a#section",
+			expected: "https://google.com/a",
+		},
+		{
+			name:     "trailing slash is kept by default",
+			url:      "https://google.com/about/",
+			expected: "https://google.com/about/",
+		},
+		{
+			name:     "trailing slash is added",
+			policy:   NormalizationPolicy{TrailingSlash: TrailingSlashAdd},
+			url:      "https://google.com/about?q=1",
+			expected: "https://google.com/about/?q=1",
+		},
+		{
+			name:     "trailing slash is not added to files",
+			policy:   NormalizationPolicy{TrailingSlash: TrailingSlashAdd},
+			url:      "https://google.com/index.html",
+			expected: "https://google.com/index.html",
+		},
+		{
+			name:     "trailing slash is removed",
+			policy:   NormalizationPolicy{TrailingSlash: TrailingSlashRemove},
+			url:      "https://google.com/about/",
+			expected: "https://google.com/about",
+		},
+		{
+			name:     "trailing slash is not removed from root",
+			policy:   NormalizationPolicy{TrailingSlash: TrailingSlashRemove},
+			url:      "https://google.com/",
+			expected: "https://google.com/",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("invalid url '%s': %s", test.url, err)
+			}
+			normalized := test.policy.Normalize(*u)
+			if normalized.String() != test.expected {
+				t.Errorf("got: %s, expected: %s", normalized.String(), test.expected)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := map[string][]string{
+		"":                {},
+		"id":              {"id"},
+		" id , page,,q ":  {"id", "page", "q"},
+		"utm_*,, ,fbclid": {"utm_*", "fbclid"},
+	}
+	for v, expected := range tests {
+		if got := SplitList(v); !reflect.DeepEqual(got, expected) {
+			t.Errorf("SplitList(%q): got: %q, want: %q", v, got, expected)
+		}
+	}
+}
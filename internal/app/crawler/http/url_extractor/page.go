@@ -0,0 +1,24 @@
+package url_extractor
+
+import (
+	"net/url"
+	"time"
+)
+
+// Page contains the information extracted from the HTML document.
+type Page struct {
+	URLs []url.URL
+	// Title is the content of the <title> element.
+	Title string
+	// Alternates are the language versions of the page (<link rel="alternate" hreflang="...">).
+	Alternates []Alternate
+	// Canonical is the URL declared with <link rel="canonical"> (nil if not declared).
+	Canonical *url.URL
+	// ModifiedTime is the modification time declared in the document (zero if not declared).
+	ModifiedTime time.Time
+}
+
+type Alternate struct {
+	Language string
+	URL      url.URL
+}
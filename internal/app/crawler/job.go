@@ -1,13 +1,42 @@
 package crawler
 
-import "net/url"
+import (
+	"net/url"
+	"time"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
+)
 
 type job struct {
 	url url.URL
+	// attempt is the number of previous failed attempts to process the url.
+	attempt int
+	// depth is the number of links between the seed URL and the url.
+	depth int
+	// validators of the page fetched by the previous crawl (incremental mode), the request is conditional.
+	validators http.Validators
 }
 
 type jobResult struct {
+	job        job
 	urls       []url.URL
 	statusCode int
-	err        error
+	title      string
+	alternates []url_extractor.Alternate
+	// canonical is the canonical URL declared by the page (nil if not declared).
+	canonical *url.URL
+	// lastModified is the modification time of the page (zero if unknown).
+	lastModified time.Time
+	retryAfter   time.Duration
+	// redirect is the target location if the server redirected the request.
+	redirect *url.URL
+	// notModified means that the page didn't change since the previous crawl (304 response to the conditional request).
+	notModified bool
+	// etag and lastModifiedHeader are the validators of the page (for the conditional requests of the next crawl).
+	etag               string
+	lastModifiedHeader string
+	// contentHash is the SHA-256 hash of the page body.
+	contentHash string
+	err         error
 }
@@ -2,93 +2,348 @@ package crawler
 
 import (
 	"context"
+	"io"
 	ohttp "net/http"
 	"net/url"
-	"strings"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/mwarzynski/crawler/internal/app/crawler/history"
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/politeness"
 	"github.com/mwarzynski/crawler/internal/app/crawler/queue"
+	"github.com/mwarzynski/crawler/internal/app/crawler/retry"
+	"github.com/mwarzynski/crawler/internal/app/crawler/robots"
 	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
 	"github.com/mwarzynski/crawler/pkg/logging"
 )
 
 type Manager struct {
-	processorWorkers int
+	options CrawlOptions
 
 	queue            queue.FIFO
-	history          *history
+	retries          *retries
+	retryPolicy      retry.Policy
+	redirects        *redirects
+	canonicals       *canonicals
+	traps            *traps
+	history          history.History
+	dispatched       int
 	sitemapGenerator *sitemap.Generator
 	fetcherCreator   http.FetcherCreator
+	scheduler        *politeness.Scheduler
+	// pages are the states of the fetched pages (only in the incremental mode).
+	pages *pages
 
-	baseURL               url.URL
-	disallowedURLPrefixes []string
-	log                   logging.Logger
+	// inFlight are the jobs sent to the processors (by URL), they are saved in the checkpoint as pending.
+	inFlight             map[string]job
+	lastCheckpoint       time.Time
+	checkpointGeneration int
+	// progressTicks fire when the progress event is due (nil if the events are disabled), progressDue is set then.
+	progressTicks <-chan time.Time
+	progressDue   bool
+
+	statsMu  sync.Mutex
+	stats    Stats
+	status   Status
+	failures []Failure
+
+	// baseURL is the first seed, it defines the scope of the crawl.
+	baseURL url.URL
+	seeds   []url.URL
+	botName string
+	scope   *scope
+	// robots are the rules of hosts in scope (fetched when the first URL of the host is found).
+	robots map[string]*robots.Rules
+	// parked are the URLs of hosts whose robots rules are being fetched (by host), they are queued
+	// when the rules arrive on robotsResults.
+	parked        map[string][]queue.Item
+	robotsResults chan robotsResult
+	// seedingSitemaps is set until the robots rules of the base URL arrive, its sitemaps seed the crawl then.
+	seedingSitemaps bool
+	// sitemapPages receives the pages listed in the sitemaps, it's nil unless the seeding is in progress.
+	sitemapPages chan []url.URL
+	log          logging.Logger
+}
+
+// robotsResult are the robots rules of the host fetched off the manager loop.
+type robotsResult struct {
+	host  string
+	rules *robots.Rules
+	err   error
 }
 
-func NewManager(processorWorkers int, baseURL url.URL, fetcherCreator http.FetcherCreator, log logging.Logger) *Manager {
+// NewManager creates the manager of the crawl starting at the seed URLs. The first seed defines the scope
+// of the crawl (seeds out of scope are ignored).
+func NewManager(
+	seeds []url.URL,
+	botName string,
+	minRequestDelay time.Duration,
+	retryPolicy retry.Policy,
+	options CrawlOptions,
+	fetcherCreator http.FetcherCreator,
+	log logging.Logger,
+) *Manager {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	normalizedSeeds := make([]url.URL, 0, len(seeds))
+	for _, seed := range seeds {
+		normalizedSeeds = append(normalizedSeeds, options.URLNormalization.Normalize(seed))
+	}
+	baseURL := url.URL{}
+	if len(normalizedSeeds) > 0 {
+		baseURL = normalizedSeeds[0]
+	}
 	return &Manager{
-		processorWorkers: processorWorkers,
-		queue:            queue.NewFIFOSlice(100),
-		history:          newHistory(),
+		options:          options,
+		retries:          newRetries(),
+		retryPolicy:      retryPolicy,
+		redirects:        newRedirects(),
+		canonicals:       newCanonicals(),
+		traps:            newTraps(options.Traps),
+		inFlight:         make(map[string]job),
+		pages:            newPages(),
 		sitemapGenerator: sitemap.NewGenerator(),
 		fetcherCreator:   fetcherCreator,
+		scheduler:        politeness.NewScheduler(minRequestDelay),
 		baseURL:          baseURL,
+		seeds:            normalizedSeeds,
+		botName:          botName,
+		scope:            newScope(baseURL, options.Scope),
+		robots:           make(map[string]*robots.Rules),
+		parked:           make(map[string][]queue.Item),
+		robotsResults:    make(chan robotsResult),
+		status:           StatusRunning,
 		log:              logging.WithFields(log, "crawler", "manager"),
 	}
 }
 
 func (m *Manager) SitemapGenerator(ctx context.Context) (*sitemap.Generator, error) {
-	disallowPrefixes, err := m.fetchRobotsRules(ctx)
-	if err != nil {
-		m.log.Debugf("fetching robots rules: %s", err)
-	}
-	m.disallowedURLPrefixes = disallowPrefixes
-
-	workers := m.processorWorkers
+	workers := m.options.Workers
 	availableWorkers := workers
 
 	jobs := make(chan job)
 	jobResults := make(chan jobResult)
 
-	gCtx, cancel := context.WithTimeout(ctx, time.Minute*10)
+	var gCtx context.Context
+	var cancel context.CancelFunc
+	if m.options.Timeout > 0 {
+		gCtx, cancel = context.WithTimeout(ctx, m.options.Timeout)
+	} else {
+		gCtx, cancel = context.WithCancel(ctx)
+	}
 	defer cancel() // exit processors when we no longer need them
+
+	q, err := newQueue(m.options.Queue)
+	if err != nil {
+		return nil, m.failed(errors.Wrap(err, "creating queue"))
+	}
+	m.queue = q
+	defer m.closeStorage("queue", m.queue)
+
+	h, err := newHistory(m.options.History)
+	if err != nil {
+		return nil, m.failed(errors.Wrap(err, "creating history"))
+	}
+	m.history = h
+	defer m.closeStorage("history", m.history)
+
+	if m.options.Incremental.Path != "" {
+		if err := m.pages.Load(m.options.Incremental.Path); err != nil {
+			return nil, m.failed(errors.Wrap(err, "loading previous crawl"))
+		}
+	}
+
 	m.initializeProcessors(gCtx, jobs, jobResults, workers)
 
-	m.addURL(m.baseURL)
+	if m.options.Checkpoint.Resume {
+		if err := m.restoreCheckpoint(gCtx); err != nil {
+			return nil, m.failed(errors.Wrap(err, "restoring checkpoint"))
+		}
+		m.log.Infof("resuming crawl '%s', queued urls: %d", m.options.Checkpoint.ID, m.queue.Len()+m.retries.Len())
+	} else {
+		for _, seed := range m.seeds {
+			if !m.inScope(m.scope.Canonicalize(seed)) {
+				m.log.Infof("seed '%s' is out of scope, skipping", seed.String())
+				continue
+			}
+			m.addURL(gCtx, seed, 0)
+		}
+		if m.options.SeedFromSitemaps {
+			m.seedingSitemaps = true
+			m.requestRobotsRules(gCtx, m.baseURL)
+		}
+	}
+	m.lastCheckpoint = time.Now()
+	if m.options.Events != nil {
+		// Ticks wake up the loop, so the progress is published also while all workers wait for slow responses.
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		m.progressTicks = ticker.C
+	}
 
+	var next *job
 	for {
-		// Try to pop the URL to process.
-		u, urlToProcessExists := m.queue.Pop()
-		// If there are no URLs to process and all workers are idle, then this is the end.
-		if !urlToProcessExists && workers == availableWorkers {
+		// Try to get the job to process (retries which are due go first).
+		if next == nil {
+			next = m.nextJob()
+		}
+		// If there are no URLs to process (or retry later, waiting for the robots rules or listed in the sitemaps
+		// being fetched) and all workers are idle, then this is the end.
+		if next == nil && m.retries.Len() == 0 && len(m.parked) == 0 && m.sitemapPages == nil &&
+			workers == availableWorkers {
 			break
 		}
 
 		// Send / Receive the Job.
 		var result *jobResult
 		workersChange := 0
-		if !urlToProcessExists {
-			result, workersChange = m.waitForResult(gCtx, jobResults)
+		if next == nil {
+			result, workersChange = m.waitForResult(gCtx, jobResults, m.retryTimer())
 		} else {
-			result, workersChange = m.scheduleJobOrWaitForResult(gCtx, job{url: u}, jobs, jobResults)
+			result, workersChange = m.scheduleJobOrWaitForResult(gCtx, *next, jobs, jobResults)
+			if workersChange < 0 {
+				// Job was sent to the processor.
+				m.inFlight[next.url.String()] = *next
+				next = nil
+			}
 		}
 		if result != nil {
-			m.handleResult(*result)
+			delete(m.inFlight, result.job.url.String())
+			m.handleResult(gCtx, *result)
 		}
 
 		// Update the workers count or exit.
 		select {
 		case <-gCtx.Done():
-			return nil, context.Canceled
+			generator, err := m.interrupted(gCtx, next)
+			m.publishProgress(workers - availableWorkers)
+			return generator, err
 		default:
 			availableWorkers += workersChange
 		}
+		if m.progressDue {
+			m.progressDue = false
+			m.publishProgress(workers - availableWorkers)
+		}
+		if m.checkpointDue() {
+			if err := m.saveCheckpoint(next); err != nil {
+				m.log.Infof("saving checkpoint: %s", err)
+			}
+		}
+	}
+	m.removeCheckpoint()
+
+	status := StatusComplete
+	if m.queue.Len() > 0 {
+		status = StatusPageLimit
+	}
+	m.setStatus(status)
+	// State of the incomplete crawl would miss some pages, so the previous one is kept.
+	if m.options.Incremental.Path != "" && status == StatusComplete {
+		if err := m.pages.Save(m.options.Incremental.Path); err != nil {
+			m.log.Infof("saving pages state: %s", err)
+		}
+	}
+	m.publishProgress(0)
+	return m.generator(), nil
+}
+
+// failed ends the crawl which couldn't be started.
+func (m *Manager) failed(err error) error {
+	m.setStatus(StatusFailed)
+	return err
+}
+
+// interrupted ends the crawl which was cancelled or timed out. Sitemap is returned only if partial results are allowed.
+// The state of the crawl is saved (if checkpoints are enabled), so it might be resumed later.
+func (m *Manager) interrupted(ctx context.Context, next *job) (*sitemap.Generator, error) {
+	status := StatusCancelled
+	if ctx.Err() == context.DeadlineExceeded {
+		status = StatusTimedOut
+	}
+	m.setStatus(status)
+	if m.options.Checkpoint.enabled() {
+		if err := m.saveCheckpoint(next); err != nil {
+			m.log.Infof("saving checkpoint: %s", err)
+		} else {
+			m.log.Infof("crawl '%s' saved, it might be resumed", m.options.Checkpoint.ID)
+		}
+	}
+	if !m.options.PartialResults {
+		return nil, context.Canceled
+	}
+	m.log.Infof("crawl ended before completion (%s), returning partial sitemap", status)
+	return m.generator(), nil
+}
+
+func (m *Manager) generator() *sitemap.Generator {
+	m.applyCanonicals()
+	m.applySitemapFilter()
+	m.sitemapGenerator.SortEntries()
+	return m.sitemapGenerator
+}
+
+func (m *Manager) setStatus(status Status) {
+	m.statsMu.Lock()
+	m.status = status
+	m.statsMu.Unlock()
+}
+
+// ID returns the ID of the crawl's checkpoints (empty if the crawl doesn't have an ID).
+func (m *Manager) ID() string {
+	return m.options.Checkpoint.ID
+}
+
+// BaseURL returns the first seed of the crawl (it defines the crawled site).
+func (m *Manager) BaseURL() url.URL {
+	return m.baseURL
+}
+
+// Status returns how the crawl ended (or StatusRunning if it's still in progress).
+func (m *Manager) Status() Status {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.status
+}
+
+func (m *Manager) nextJob() *job {
+	if j, ok := m.retries.PopDue(time.Now()); ok {
+		return &j
+	}
+	if m.options.MaxPages > 0 && m.dispatched >= m.options.MaxPages {
+		return nil
+	}
+	if item, ok := m.queue.Pop(); ok {
+		m.dispatched++
+		return &job{url: item.URL, depth: item.Depth, validators: m.pages.Validators(item.URL)}
+	}
+	return nil
+}
+
+// closeStorage reports the errors of the disk-backed queue or history and removes its files.
+func (m *Manager) closeStorage(name string, storage interface{}) {
+	if s, ok := storage.(interface{ Err() error }); ok && s.Err() != nil {
+		m.log.Infof("%s: %s", name, s.Err())
+	}
+	if s, ok := storage.(io.Closer); ok {
+		if err := s.Close(); err != nil {
+			m.log.Infof("closing %s: %s", name, err)
+		}
 	}
+}
 
-	return m.sitemapGenerator, nil
+// retryTimer fires when the earliest retry is due. Returns nil channel (blocking forever) if there are no retries.
+func (m *Manager) retryTimer() <-chan time.Time {
+	next, ok := m.retries.Next()
+	if !ok {
+		return nil
+	}
+	return time.After(time.Until(next))
 }
 
 func (m *Manager) initializeProcessors(
@@ -99,7 +354,8 @@ func (m *Manager) initializeProcessors(
 ) {
 	fetcher := m.fetcherCreator()
 	for i := 0; i < workers; i++ {
-		processor := newProcessor(fetcher, m.baseURL, m.log)
+		processor := newProcessor(fetcher, m.scheduler, m.options.URLNormalization, m.options.RequestTimeout,
+			m.baseURL, m.log)
 		_ = processor.Run(ctx, jobs, jobResults)
 	}
 }
@@ -115,73 +371,503 @@ func (m *Manager) scheduleJobOrWaitForResult(
 		return nil, -1
 	case r := <-jobResults:
 		return &r, 1
+	case r := <-m.robotsResults:
+		m.handleRobotsResult(ctx, r)
+		return nil, 0
+	case pages, ok := <-m.sitemapPages:
+		m.handleSitemapPages(ctx, pages, ok)
+		return nil, 0
+	case <-m.progressTicks:
+		m.progressDue = true
+		return nil, 0
 	case <-ctx.Done():
 		return nil, 0
 	}
 }
 
-func (m *Manager) waitForResult(ctx context.Context, jobResults <-chan jobResult) (*jobResult, int) {
+func (m *Manager) waitForResult(
+	ctx context.Context,
+	jobResults <-chan jobResult,
+	retryTimer <-chan time.Time,
+) (*jobResult, int) {
 	select {
 	case result := <-jobResults:
 		return &result, 1
+	case <-retryTimer:
+		return nil, 0
+	case r := <-m.robotsResults:
+		m.handleRobotsResult(ctx, r)
+		return nil, 0
+	case pages, ok := <-m.sitemapPages:
+		m.handleSitemapPages(ctx, pages, ok)
+		return nil, 0
+	case <-m.progressTicks:
+		m.progressDue = true
+		return nil, 0
 	case <-ctx.Done():
 		return nil, 0
 	}
 }
 
-func (m *Manager) handleResult(result jobResult) {
-	if result.statusCode == ohttp.StatusNotFound {
+// Stats returns the current state of the crawl.
+func (m *Manager) Stats() Stats {
+	m.statsMu.Lock()
+	stats := m.stats
+	m.statsMu.Unlock()
+	stats.RequestDelay = m.scheduler.Delay(m.baseURL.Host)
+	stats.RequestsPerSecond = m.scheduler.RequestsPerSecond(m.baseURL.Host)
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	stats.HeapInUse = memStats.HeapInuse
+	return stats
+}
+
+// Failures returns the URLs which couldn't be processed along with the reason.
+func (m *Manager) Failures() []Failure {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return append([]Failure{}, m.failures...)
+}
+
+// Redirects returns the chains of redirects encountered during the crawl.
+func (m *Manager) Redirects() []Redirect {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.redirects.Chains(m.inScope)
+}
+
+// Truncations returns the URL patterns which weren't crawled completely, because they look like crawl traps.
+func (m *Manager) Truncations() []Truncation {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.traps.Truncations()
+}
+
+func (m *Manager) handleResult(ctx context.Context, result jobResult) {
+	m.statsMu.Lock()
+	m.stats.Fetched++
+	m.statsMu.Unlock()
+	if result.redirect != nil || result.notModified || (result.statusCode == ohttp.StatusOK && result.err == nil) {
+		m.publish(Event{
+			Type:       EventFetched,
+			URL:        result.job.url,
+			Depth:      result.job.depth,
+			StatusCode: result.statusCode,
+		})
+	}
+	if result.redirect != nil {
+		m.handleRedirect(ctx, result)
+		return
+	}
+	if result.notModified {
+		m.handleNotModified(ctx, result)
 		return
 	}
 	if result.statusCode != ohttp.StatusOK || result.err != nil {
-		m.log.Infof("fetching, status code=%d, err: %s", result.statusCode, result.err)
+		m.handleFailure(result)
+		return
 	}
-	for _, u := range result.urls {
-		m.addURL(u)
+	alternates := make([]sitemap.Alternate, 0, len(result.alternates))
+	for _, alternate := range result.alternates {
+		alternates = append(alternates, sitemap.Alternate{
+			Language: alternate.Language,
+			Location: alternate.URL,
+		})
 	}
+	entry := sitemap.Entry{
+		Location:     result.job.url,
+		Title:        result.title,
+		LastModified: result.lastModified,
+		Alternates:   alternates,
+	}
+	if m.options.Incremental.Path != "" {
+		if m.pages.Unchanged(result.job.url, result.contentHash) {
+			m.statsMu.Lock()
+			m.stats.Unchanged++
+			m.statsMu.Unlock()
+		}
+		entry.LastModified = m.pages.lastModified(result, time.Now())
+		m.pages.Set(newPageState(entry, result))
+	}
+	m.sitemapGenerator.AddEntry(entry)
+	m.addPageURLs(ctx, result.job, result.urls, result.canonical)
 }
 
-func (m *Manager) addURL(url url.URL) {
-	if url.Host != m.baseURL.Host {
+// handleNotModified reuses the entry and the links of the page which didn't change since the previous crawl.
+func (m *Manager) handleNotModified(ctx context.Context, result jobResult) {
+	previous, ok := m.pages.Previous(result.job.url)
+	if !ok {
+		// We send the conditional requests only for the pages fetched by the previous crawl.
+		result.err = errors.New("not modified response to the unconditional request")
+		m.handleFailure(result)
 		return
 	}
-	urlRaw := url.String()
-	if !strings.HasPrefix(urlRaw, m.baseURL.String()) {
+	entry, err := previous.Entry.entry()
+	if err != nil {
+		result.err = err
+		m.handleFailure(result)
 		return
 	}
-	for _, prefix := range m.disallowedURLPrefixes {
-		if strings.HasPrefix(urlRaw, prefix) {
-			return
+	m.statsMu.Lock()
+	m.stats.NotModified++
+	m.statsMu.Unlock()
+	m.pages.Set(previous)
+	m.sitemapGenerator.AddEntry(entry)
+	urls, canonical := previous.links()
+	m.addPageURLs(ctx, result.job, urls, canonical)
+}
+
+// addPageURLs adds the canonical URL and the links of the fetched page to the queue.
+func (m *Manager) addPageURLs(ctx context.Context, j job, urls []url.URL, canonical *url.URL) {
+	if canonical != nil {
+		m.statsMu.Lock()
+		m.canonicals.Add(j.url, *canonical)
+		m.statsMu.Unlock()
+		// Canonical page should be fetched as well, so we know if it's valid. It's the next level like the links,
+		// so the canonical chains are bounded by MaxDepth.
+		m.addURL(ctx, *canonical, j.depth+1)
+	}
+	if m.options.MaxDepth > 0 && j.depth >= m.options.MaxDepth {
+		return
+	}
+	for _, u := range urls {
+		m.addURL(ctx, u, j.depth+1)
+	}
+}
+
+// CanonicalIssues returns the canonical chains and cross-host canonicals found during the crawl.
+func (m *Manager) CanonicalIssues() []CanonicalIssue {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.canonicals.Issues()
+}
+
+// applyCanonicals replaces the entries with their canonical URLs and removes the duplicates.
+// Canonical URL is used only if it was successfully fetched (so it's in scope and allowed by robots).
+// Entry of the canonical page itself is preferred over entries of its duplicates.
+func (m *Manager) applyCanonicals() {
+	entries := m.sitemapGenerator.Entries
+	fetched := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		fetched[entry.Location.String()] = true
+	}
+	allowed := func(u url.URL) bool {
+		return fetched[u.String()]
+	}
+
+	index := make(map[string]int, len(entries))
+	deduplicated := make([]sitemap.Entry, 0, len(entries))
+	for _, entry := range entries {
+		canonical := m.canonicals.Resolve(entry.Location, allowed)
+		self := canonical.String() == entry.Location.String()
+		entry.Location = canonical
+		if i, ok := index[canonical.String()]; ok {
+			if self {
+				deduplicated[i] = entry
+			}
+			continue
 		}
+		index[canonical.String()] = len(deduplicated)
+		deduplicated = append(deduplicated, entry)
 	}
-	if m.history.URLWasAlreadyProcessed(url) {
+	m.sitemapGenerator.Entries = deduplicated
+}
+
+// applySitemapFilter removes the entries which were crawled, but shouldn't be listed in the sitemap.
+func (m *Manager) applySitemapFilter() {
+	entries := make([]sitemap.Entry, 0, len(m.sitemapGenerator.Entries))
+	for _, entry := range m.sitemapGenerator.Entries {
+		if m.options.SitemapFilter.Allow(entry.Location) {
+			entries = append(entries, entry)
+		}
+	}
+	m.sitemapGenerator.Entries = entries
+}
+
+// handleRedirect schedules the redirect target instead of adding the redirecting URL to the sitemap.
+// Off-site targets are dropped by addURL as any other link.
+func (m *Manager) handleRedirect(ctx context.Context, result jobResult) {
+	from, to := result.job.url, *result.redirect
+	m.statsMu.Lock()
+	m.redirects.Add(from, result.statusCode, to)
+	loop := m.redirects.Loop(from)
+	m.statsMu.Unlock()
+	if loop {
+		m.log.Infof("redirect loop detected at '%s'", from.String())
+		m.addFailure(Failure{
+			URL:        from,
+			StatusCode: result.statusCode,
+			Attempts:   result.job.attempt + 1,
+			Reason:     "redirect loop",
+		})
+		return
+	}
+	// Target counts as the next level, so the redirect chains are bounded by MaxDepth like the links.
+	m.addURL(ctx, to, result.job.depth+1)
+}
+
+func (m *Manager) handleFailure(result jobResult) {
+	j := result.job
+	if m.retryPolicy.ShouldRetry(j.attempt, result.statusCode, result.err) {
+		delay := m.retryPolicy.Backoff(j.attempt, result.retryAfter)
+		m.log.Debugf("retrying '%s' in %s, status code=%d, err: %s", j.url.String(), delay, result.statusCode, result.err)
+		m.retries.Push(job{url: j.url, attempt: j.attempt + 1, depth: j.depth, validators: j.validators},
+			time.Now().Add(delay))
+		m.statsMu.Lock()
+		m.stats.Retried++
+		m.statsMu.Unlock()
 		return
 	}
-	m.sitemapGenerator.AddEntry(sitemap.Entry{
-		Location: url,
+
+	if result.statusCode != ohttp.StatusNotFound {
+		m.log.Infof("fetching, status code=%d, err: %s", result.statusCode, result.err)
+	}
+	reason := ohttp.StatusText(result.statusCode)
+	if result.err != nil {
+		reason = result.err.Error()
+	}
+	m.addFailure(Failure{
+		URL:        j.url,
+		StatusCode: result.statusCode,
+		Attempts:   j.attempt + 1,
+		Reason:     reason,
+	})
+}
+
+func (m *Manager) addFailure(failure Failure) {
+	m.statsMu.Lock()
+	m.stats.Failed++
+	m.failures = append(m.failures, failure)
+	m.statsMu.Unlock()
+	m.publish(Event{
+		Type:       EventFailed,
+		URL:        failure.URL,
+		StatusCode: failure.StatusCode,
+		Reason:     failure.Reason,
 	})
+}
+
+func (m *Manager) inScope(u url.URL) bool {
+	return m.scope.Contains(u)
+}
+
+func (m *Manager) addURL(ctx context.Context, url url.URL, depth int) {
+	url = m.scope.Canonicalize(url)
+	if !m.inScope(url) {
+		return
+	}
+	if depth > 0 && !m.options.CrawlFilter.Allow(url) {
+		return
+	}
+	if m.options.MaxDepth > 0 && depth > m.options.MaxDepth {
+		return
+	}
+	rules, ok := m.robots[url.Host]
+	if !ok {
+		m.requestRobotsRules(ctx, url)
+		m.parked[url.Host] = append(m.parked[url.Host], queue.Item{URL: url, Depth: depth})
+		return
+	}
+	m.queueURL(rules, url, depth)
+}
+
+// queueURL adds the URL to the queue unless it's disallowed by the robots rules of its host, was already
+// processed or looks like a crawl trap.
+func (m *Manager) queueURL(rules *robots.Rules, url url.URL, depth int) {
+	if !rules.IsAllowed(url) {
+		m.publish(Event{Type: EventRobotsSkipped, URL: url, Depth: depth})
+		return
+	}
+	if m.history.URLWasAlreadyProcessed(url) {
+		return
+	}
 	m.history.SetURLProcessed(url)
-	m.queue.Push(url)
+	m.statsMu.Lock()
+	m.stats.Processed = m.history.Len()
+	m.stats.HistoryMemory = m.history.MemoryUsage()
+	allowed := m.traps.Allow(url)
+	if !allowed {
+		m.stats.Truncated++
+	}
+	m.statsMu.Unlock()
+	if !allowed {
+		m.log.Debugf("skipping '%s', it looks like a crawl trap", url.String())
+		return
+	}
+	m.queue.Push(queue.Item{URL: url, Depth: depth})
+	m.publish(Event{Type: EventDiscovered, URL: url, Depth: depth})
+}
+
+// requestRobotsRules starts fetching the robots.txt rules of the URL's host (unless they are already fetched or
+// being fetched). Fetching might take a while (redirects, slow hosts), so it doesn't block the manager loop.
+func (m *Manager) requestRobotsRules(ctx context.Context, u url.URL) {
+	if _, ok := m.robots[u.Host]; ok {
+		return
+	}
+	if _, fetching := m.parked[u.Host]; fetching {
+		return
+	}
+	m.parked[u.Host] = nil
+	go func() {
+		rules, err := m.fetchRobotsRules(ctx, u)
+		select {
+		case m.robotsResults <- robotsResult{host: u.Host, rules: rules, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// handleRobotsResult saves the fetched robots rules, passes the host's Crawl-delay to the scheduler and queues
+// the URLs parked until the rules arrived.
+func (m *Manager) handleRobotsResult(ctx context.Context, r robotsResult) {
+	if r.err != nil {
+		m.log.Infof("fetching robots rules of '%s': %s", r.host, r.err)
+	}
+	m.robots[r.host] = r.rules
+	if r.rules.RequestedCrawlDelay() > r.rules.CrawlDelay() {
+		m.log.Infof("Crawl-delay of '%s' (%s) is too long, using %s", r.host, r.rules.RequestedCrawlDelay(), r.rules.CrawlDelay())
+	}
+	m.scheduler.SetCrawlDelay(r.host, r.rules.CrawlDelay())
+
+	parked := m.parked[r.host]
+	delete(m.parked, r.host)
+	for _, item := range parked {
+		m.queueURL(r.rules, item.URL, item.Depth)
+	}
+	if m.seedingSitemaps && r.host == m.baseURL.Host {
+		m.seedingSitemaps = false
+		m.sitemapPages = make(chan []url.URL)
+		go m.seedFromSitemaps(ctx, r.rules.Sitemaps(), m.sitemapPages)
+	}
 }
 
-func (m *Manager) fetchRobotsRules(ctx context.Context) ([]string, error) {
-	robotsURL := m.baseURL
-	robotsURL.Path += "/robots.txt"
-	body, statusCode, err := m.fetcherCreator().Fetch(ctx, robotsURL)
+// fetchRobotsRules fetches the /robots.txt of the URL's host and selects the rules for our bot.
+// Following the RFC 9309: if robots.txt is unavailable (4xx), then we are allowed to crawl everything.
+// If it's unreachable (5xx, network errors), then we must assume that crawling is disallowed.
+func (m *Manager) fetchRobotsRules(ctx context.Context, u url.URL) (*robots.Rules, error) {
+	robotsURL := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "/robots.txt",
+	}
+	// RFC 9309 says we should follow at least five consecutive redirects.
+	resp, err := fetchFollowingRedirects(ctx, m.fetcherCreator(), robotsURL, 5, http.FetchOptions{}, nil)
+	if resp == nil {
+		return robots.DisallowAll(), errors.Wrap(err, "fetching robots.txt")
+	}
+	if resp.StatusCode >= ohttp.StatusBadRequest && resp.StatusCode < ohttp.StatusInternalServerError {
+		return robots.AllowAll(), nil
+	}
+	if http.IsRedirect(resp.StatusCode) {
+		// Too many (or invalid) redirects, RFC 9309 allows to treat it as unavailable.
+		return robots.AllowAll(), errors.Wrap(err, "robots.txt redirects")
+	}
 	if err != nil {
-		return nil, errors.Wrapf(err, "Status Code=%d", statusCode)
+		return robots.DisallowAll(), errors.Wrapf(err, "Status Code=%d", resp.StatusCode)
+	}
+	return robots.Parse(resp.Body, m.botName), nil
+}
+
+// maxSeedSitemaps limits the number of sitemap files fetched to seed the crawl (sitemap indexes might be huge).
+const maxSeedSitemaps = 1000
+
+// seedFromSitemaps fetches the site's sitemaps (robots.txt Sitemap records of the base URL's host or /sitemap.xml)
+// and sends the listed pages to the manager loop, while the crawl is already running. Sitemap indexes are followed,
+// but only the sitemaps located on the hosts in scope are fetched. Pages channel is closed when the seeding ends.
+func (m *Manager) seedFromSitemaps(ctx context.Context, sitemaps []string, pages chan<- []url.URL) {
+	defer close(pages)
+	pending := make([]url.URL, 0)
+	for _, location := range sitemaps {
+		if u, err := m.baseURL.Parse(location); err == nil {
+			pending = append(pending, *u)
+		}
+	}
+	if len(pending) == 0 {
+		pending = append(pending, url.URL{Scheme: m.baseURL.Scheme, Host: m.baseURL.Host, Path: "/sitemap.xml"})
 	}
 
-	disallows := make([]string, 0)
-	lines := strings.Split(string(body), "\n")
-	for _, line := range lines {
-		if !strings.HasPrefix(line, "Disallow: ") {
+	fetcher := m.fetcherCreator()
+	visited := make(map[string]bool)
+	for len(pending) > 0 && len(visited) < maxSeedSitemaps && ctx.Err() == nil {
+		u := pending[0]
+		pending = pending[1:]
+		if visited[u.String()] {
 			continue
 		}
-		disallowURL := m.baseURL
-		disallowURL.Path = strings.Replace(line, "Disallow: ", "", 1)
-		disallows = append(disallows, disallowURL.String())
+		visited[u.String()] = true
+		if !m.scope.ContainsHost(u) {
+			m.log.Infof("skipping sitemap '%s', its host is out of scope", u.String())
+			continue
+		}
+
+		doc, err := m.fetchSitemap(ctx, fetcher, u)
+		if err != nil {
+			m.log.Infof("seeding from sitemap '%s': %s", u.String(), err)
+			continue
+		}
+		pending = append(pending, doc.Sitemaps...)
+		urls := make([]url.URL, 0, len(doc.URLs))
+		for _, page := range doc.URLs {
+			urls = append(urls, m.options.URLNormalization.Normalize(page))
+		}
+		select {
+		case pages <- urls:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSitemapPages adds the pages listed in the sitemap. They are treated as linked from the seed, so they are
+// subject to the crawl filter and depth limit as any other link.
+func (m *Manager) handleSitemapPages(ctx context.Context, pages []url.URL, ok bool) {
+	if !ok {
+		m.sitemapPages = nil
+		return
 	}
+	for _, page := range pages {
+		m.addURL(ctx, page, 1)
+	}
+}
+
+func (m *Manager) fetchSitemap(ctx context.Context, fetcher http.Fetcher, u url.URL) (*sitemap.Document, error) {
+	if err := m.scheduler.Wait(ctx, u.Host); err != nil {
+		return nil, errors.Wrap(err, "waiting for the request slot")
+	}
+	// Valid sitemaps might be larger than the pages (up to sitemap.MaxFileSize uncompressed).
+	options := http.FetchOptions{MaxBodySize: sitemap.MaxFileSize}
+	resp, err := fetchFollowingRedirects(ctx, fetcher, u, 5, options, m.scope.ContainsHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching sitemap")
+	}
+	return sitemap.Parse(resp.Body)
+}
 
-	return disallows, nil
+// fetchFollowingRedirects fetches the resource which is not a part of the crawl (robots.txt, sitemaps),
+// so the redirects are followed immediately instead of being recorded. Redirects are followed only to the URLs
+// allowed by the follow function (nil allows all).
+func fetchFollowingRedirects(
+	ctx context.Context,
+	fetcher http.Fetcher,
+	u url.URL,
+	maxRedirects int,
+	options http.FetchOptions,
+	follow func(url.URL) bool,
+) (*http.Response, error) {
+	resp, err := fetcher.Fetch(ctx, u, options)
+	for redirects := 0; resp != nil && http.IsRedirect(resp.StatusCode); redirects++ {
+		if redirects == maxRedirects {
+			return resp, errors.Errorf("too many redirects")
+		}
+		location, parseErr := u.Parse(resp.Header.Get("Location"))
+		if parseErr != nil {
+			return resp, errors.Wrap(parseErr, "invalid redirect location")
+		}
+		if follow != nil && !follow(*location) {
+			return resp, errors.Errorf("redirect to '%s' isn't allowed", location.String())
+		}
+		u = *location
+		resp, err = fetcher.Fetch(ctx, u, options)
+	}
+	return resp, err
 }
@@ -3,55 +3,153 @@ package crawler
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	ohttp "net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler/filter"
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/retry"
+	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
 	"github.com/sirupsen/logrus"
 )
 
 type mockFetcher struct {
 	baseURL            url.URL
 	disallowedPrefixes []string
+	allowedPrefixes    []string
 	urls               map[string][]string
+	redirects          map[string]string
+	canonicals         map[string]string
+	robotsSitemaps     []string
+	files              map[string][]byte // Map: url -> raw body (e.g. sitemap).
+	hanging            map[string]bool   // URLs which don't respond until the request is cancelled.
+	etags              map[string]string // Map: url -> ETag of the page (304 is returned if it matches If-None-Match).
+
+	mu       sync.Mutex
+	failures map[string]int // Number of 503 responses before the site is served.
 }
 
-func (mf *mockFetcher) Fetch(ctx context.Context, url url.URL) ([]byte, int, error) {
-	if mf.baseURL.String()+"/robots.txt" == url.String() {
-		return mf.fetchRobots()
+func (mf *mockFetcher) Fetch(ctx context.Context, url url.URL, options http.FetchOptions) (*http.Response, error) {
+	if mf.baseURL.Scheme+"://"+mf.baseURL.Host+"/robots.txt" == url.String() {
+		return mf.fetchRobots(url)
+	}
+	mf.mu.Lock()
+	if mf.failures[url.String()] > 0 {
+		mf.failures[url.String()]--
+		mf.mu.Unlock()
+		return mf.response(url, ohttp.StatusServiceUnavailable, nil), http.ErrInvalidStatusCode
+	}
+	mf.mu.Unlock()
+	if mf.hanging[url.String()] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if body, ok := mf.files[url.String()]; ok {
+		return mf.response(url, ohttp.StatusOK, body), nil
+	}
+	if location, ok := mf.redirects[url.String()]; ok {
+		resp := mf.response(url, ohttp.StatusMovedPermanently, nil)
+		resp.Header.Set("Location", location)
+		return resp, http.ErrInvalidStatusCode
+	}
+	if etag, ok := mf.etags[url.String()]; ok {
+		if options.Validators.ETag == etag {
+			return mf.response(url, ohttp.StatusNotModified, nil), http.ErrInvalidStatusCode
+		}
+		resp, err := mf.fetchSite(url)
+		resp.Header.Set("ETag", etag)
+		return resp, err
 	}
 	return mf.fetchSite(url)
 }
 
-func (mf *mockFetcher) fetchRobots() ([]byte, int, error) {
-	robots := ""
+func (mf *mockFetcher) response(url url.URL, statusCode int, body []byte) *http.Response {
+	return &http.Response{
+		Body:          body,
+		StatusCode:    statusCode,
+		Header:        make(ohttp.Header),
+		URL:           url,
+		ContentLength: int64(len(body)),
+		Protocol:      "HTTP/1.1",
+	}
+}
+
+func (mf *mockFetcher) fetchRobots(url url.URL) (*http.Response, error) {
+	robots := "User-agent: *\n"
 	for _, disallowedPrefix := range mf.disallowedPrefixes {
 		robots += fmt.Sprintf("Disallow: %s\n", disallowedPrefix)
 	}
-	return []byte(robots), ohttp.StatusOK, nil
+	for _, allowedPrefix := range mf.allowedPrefixes {
+		robots += fmt.Sprintf("Allow: %s\n", allowedPrefix)
+	}
+	for _, sitemapURL := range mf.robotsSitemaps {
+		robots += fmt.Sprintf("Sitemap: %s\n", sitemapURL)
+	}
+	return mf.response(url, ohttp.StatusOK, []byte(robots)), nil
 }
 
-func (mf *mockFetcher) fetchSite(url url.URL) ([]byte, int, error) {
+func (mf *mockFetcher) fetchSite(url url.URL) (*http.Response, error) {
 	generateHTML := func(urls []string) []byte {
-		html := "<html><body>"
+		html := "<html><head>"
+		if canonical, ok := mf.canonicals[url.String()]; ok {
+			html += fmt.Sprintf(`<link rel="canonical" href="%s">`, canonical)
+		}
+		html += "</head><body>"
 		for _, url := range urls {
 			html += fmt.Sprintf(`<a href="%s">%s</a>`, url, url)
 		}
 		html += "</body></html>"
 		return []byte(html)
 	}
-	return generateHTML(mf.urls[url.String()]), ohttp.StatusOK, nil
+	return mf.response(url, ohttp.StatusOK, generateHTML(mf.links(url))), nil
+}
+
+// links returns the links of the page. Fixtures might use the root URL without the trailing slash, which
+// is normalized to '/' by the crawler.
+func (mf *mockFetcher) links(url url.URL) []string {
+	if links, ok := mf.urls[url.String()]; ok || url.Path != "/" || url.RawQuery != "" {
+		return links
+	}
+	return mf.urls[strings.TrimSuffix(url.String(), "/")]
 }
 
 func TestManager(t *testing.T) {
 	log := logrus.New()
+	retryPolicy := retry.Policy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond * 10,
+	}
 	tests := []struct {
 		name             string              // Name of the test.
 		baseURL          string              // BaseURL that user provides as input.
 		pageLinks        map[string][]string // Map: url -> urls; Graph of our site.
 		robotsDisallowed []string            // Robots functionality, entry: 'Disallow: prefix'
+		robotsAllowed    []string            // Robots functionality, entry: 'Allow: prefix'
+		pageFailures     map[string]int      // Map: url -> number of 503 responses before the page is served.
+		redirects        map[string]string   // Map: url -> redirect location.
+		canonicals       map[string]string   // Map: url -> declared canonical URL.
+		maxPages         int                 // Crawl option: maximum number of fetched pages.
+		maxDepth         int                 // Crawl option: maximum number of links from the base URL.
+		scope            ScopeMode           // Crawl option: which hosts are crawled.
+		queue            QueueType           // Crawl option: implementation of the queue.
+		history          HistoryType         // Crawl option: implementation of the history.
+		crawlExclude     []string            // Crawl option: patterns of URLs which are not crawled.
+		sitemapExclude   []string            // Crawl option: patterns of URLs which are not listed in the sitemap.
 		expectedLinks    []string            // Expected output links (that goes to sitemap).
+		expectedFailures []string            // Expected URLs that couldn't be fetched (after retries).
+		expectedAttempts int                 // Expected attempts of each failure (default: all retries are used).
 	}{
 		{
 			name:    "simple site with only one page",
@@ -59,7 +157,7 @@ func TestManager(t *testing.T) {
 			pageLinks: map[string][]string{
 				"https://google.com": []string{},
 			},
-			expectedLinks: []string{"https://google.com"},
+			expectedLinks: []string{"https://google.com/"},
 		},
 		{
 			name:    "site with two sites that point to each other",
@@ -73,7 +171,7 @@ func TestManager(t *testing.T) {
 				},
 			},
 			expectedLinks: []string{
-				"https://google.com",
+				"https://google.com/",
 				"https://google.com/1",
 			},
 		},
@@ -92,7 +190,269 @@ func TestManager(t *testing.T) {
 				},
 			},
 			expectedLinks: []string{
-				"https://google.com",
+				"https://google.com/",
+			},
+		},
+		{
+			name:    "site with disallowed directory, but one page is allowed by robots",
+			baseURL: "https://google.com",
+			robotsDisallowed: []string{
+				"/blog",
+			},
+			robotsAllowed: []string{
+				"/blog/welcome$",
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/blog/welcome",
+					"https://google.com/blog/welcome/2",
+					"https://google.com/blog",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/blog/welcome",
+			},
+		},
+		{
+			name:    "site with page that is temporarily unavailable",
+			baseURL: "https://google.com",
+			pageFailures: map[string]int{
+				"https://google.com/1": 2,
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/1",
+				},
+				"https://google.com/1": []string{
+					"https://google.com/2",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/2",
+			},
+		},
+		{
+			name:    "site with page that is unavailable",
+			baseURL: "https://google.com",
+			pageFailures: map[string]int{
+				"https://google.com/1": 10,
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/1",
+				},
+				"https://google.com/1": []string{
+					"https://google.com/2",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+			},
+			expectedFailures: []string{
+				"https://google.com/1",
+			},
+		},
+		{
+			name:    "site with redirects to the same site and off-site",
+			baseURL: "https://google.com",
+			redirects: map[string]string{
+				"https://google.com/old":      "/new",
+				"https://google.com/external": "https://bing.com/",
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/old",
+					"https://google.com/external",
+				},
+				"https://google.com/new": []string{
+					"https://google.com/1",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/new",
+			},
+		},
+		{
+			name:    "site with redirect loop",
+			baseURL: "https://google.com",
+			redirects: map[string]string{
+				"https://google.com/a": "https://google.com/b",
+				"https://google.com/b": "https://google.com/a",
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/a",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+			},
+			expectedFailures: []string{
+				"https://google.com/b",
+			},
+			// Redirect loop isn't retried.
+			expectedAttempts: 1,
+		},
+		{
+			name:    "site with duplicated pages declaring canonical URLs",
+			baseURL: "https://google.com",
+			canonicals: map[string]string{
+				"https://google.com/a?sort=asc":  "/a",
+				"https://google.com/a?sort=desc": "https://google.com/a",
+				"https://google.com/b":           "https://google.com/c",
+				"https://google.com/d":           "https://bing.com/d",
+			},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/a?sort=asc",
+					"https://google.com/a?sort=desc",
+					"https://google.com/b",
+					"https://google.com/d",
+				},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/a",
+				"https://google.com/c",
+				"https://google.com/d",
+			},
+		},
+		{
+			name:     "crawl limited by depth",
+			baseURL:  "https://google.com",
+			maxDepth: 1,
+			pageLinks: map[string][]string{
+				"https://google.com":   []string{"https://google.com/1"},
+				"https://google.com/1": []string{"https://google.com/2"},
+				"https://google.com/2": []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+			},
+		},
+		{
+			name:     "crawl limited by number of pages",
+			baseURL:  "https://google.com",
+			maxPages: 2,
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/1",
+					"https://google.com/2",
+					"https://google.com/3",
+				},
+				"https://google.com/1": []string{},
+				"https://google.com/2": []string{},
+				"https://google.com/3": []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+			},
+		},
+		{
+			name:           "crawl and sitemap filters",
+			baseURL:        "https://google.com",
+			crawlExclude:   []string{"/private/*"},
+			sitemapExclude: []string{"/tag/*"},
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"https://google.com/tag/a",
+					"https://google.com/private/a",
+				},
+				"https://google.com/tag/a":     []string{"https://google.com/post"},
+				"https://google.com/private/a": []string{},
+				"https://google.com/post":      []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/post",
+			},
+		},
+		{
+			name:    "site with www alias and http links",
+			baseURL: "https://google.com",
+			scope:   ScopeWWW,
+			pageLinks: map[string][]string{
+				"https://google.com": []string{
+					"http://google.com/1",
+					"https://www.google.com/2",
+					"https://mail.google.com/",
+				},
+				"https://google.com/1":     []string{},
+				"https://www.google.com/2": []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://www.google.com/2",
+			},
+		},
+		{
+			name:    "site crawled with disk queue",
+			baseURL: "https://google.com",
+			queue:   QueueDisk,
+			pageLinks: map[string][]string{
+				"https://google.com":   []string{"https://google.com/1", "https://google.com/2"},
+				"https://google.com/1": []string{"https://google.com/3"},
+				"https://google.com/2": []string{"https://google.com/3"},
+				"https://google.com/3": []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/2",
+				"https://google.com/3",
+			},
+		},
+		{
+			name:    "site crawled with ring queue",
+			baseURL: "https://google.com",
+			queue:   QueueRing,
+			pageLinks: map[string][]string{
+				"https://google.com":   []string{"https://google.com/1", "https://google.com/2"},
+				"https://google.com/1": []string{},
+				"https://google.com/2": []string{},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/2",
+			},
+		},
+		{
+			name:    "site crawled with bloom history",
+			baseURL: "https://google.com",
+			history: HistoryBloom,
+			pageLinks: map[string][]string{
+				"https://google.com":   []string{"https://google.com/1", "https://google.com/2"},
+				"https://google.com/1": []string{"https://google.com", "https://google.com/2"},
+				"https://google.com/2": []string{"https://google.com/1"},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/2",
+			},
+		},
+		{
+			name:    "site crawled with disk history",
+			baseURL: "https://google.com",
+			history: HistoryDisk,
+			pageLinks: map[string][]string{
+				"https://google.com":   []string{"https://google.com/1", "https://google.com/2"},
+				"https://google.com/1": []string{"https://google.com", "https://google.com/2"},
+				"https://google.com/2": []string{"https://google.com/1"},
+			},
+			expectedLinks: []string{
+				"https://google.com/",
+				"https://google.com/1",
+				"https://google.com/2",
 			},
 		},
 		// It should be relatively easy, to test new site configurations / functionalities.
@@ -105,20 +465,58 @@ func TestManager(t *testing.T) {
 			if err != nil {
 				t.Fatalf("invalid base URL '%s': %s", test.baseURL, err)
 			}
+			failures := make(map[string]int)
+			for u, n := range test.pageFailures {
+				failures[u] = n
+			}
+			mf := &mockFetcher{
+				disallowedPrefixes: test.robotsDisallowed,
+				allowedPrefixes:    test.robotsAllowed,
+				baseURL:            *baseURL,
+				urls:               test.pageLinks,
+				redirects:          test.redirects,
+				canonicals:         test.canonicals,
+				failures:           failures,
+			}
 			fetcherCreator := func() http.Fetcher {
-				return &mockFetcher{
-					disallowedPrefixes: test.robotsDisallowed,
-					baseURL:            *baseURL,
-					urls:               test.pageLinks,
-				}
+				return mf
+			}
+			options := DefaultCrawlOptions()
+			options.Workers = 3
+			options.MaxPages = test.maxPages
+			options.MaxDepth = test.maxDepth
+			if test.scope != "" {
+				options.Scope.Mode = test.scope
+			}
+			if test.queue != "" {
+				options.Queue = QueueOptions{Type: test.queue, SegmentSize: 1}
+			}
+			if test.history != "" {
+				options.History.Type = test.history
 			}
-			manager := NewManager(3, *baseURL, fetcherCreator, log)
+			if options.CrawlFilter, err = filter.Parse(nil, test.crawlExclude); err != nil {
+				t.Fatalf("invalid crawl filter: %s", err)
+			}
+			if options.SitemapFilter, err = filter.Parse(nil, test.sitemapExclude); err != nil {
+				t.Fatalf("invalid sitemap filter: %s", err)
+			}
+			manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retryPolicy, options, fetcherCreator, log)
 
 			ctx := context.Background()
 			sg, err := manager.SitemapGenerator(ctx)
 			if err != nil {
 				t.Fatalf("couldn't generate sitemap: %s", err)
 			}
+			expectedStatus := StatusComplete
+			if test.maxPages > 0 {
+				expectedStatus = StatusPageLimit
+			}
+			if status := manager.Status(); status != expectedStatus {
+				t.Errorf("invalid crawl status: got: %s, want: %s", status, expectedStatus)
+			}
+			if stats := manager.Stats(); stats.Processed < len(test.expectedLinks) || stats.HistoryMemory <= 0 {
+				t.Errorf("invalid history stats: processed: %d, memory: %d", stats.Processed, stats.HistoryMemory)
+			}
 
 			if len(sg.Entries) != len(test.expectedLinks) {
 				t.Fatalf("received invalid number of links: got: %d, want: %d\nsitemap: %v",
@@ -130,6 +528,475 @@ func TestManager(t *testing.T) {
 						i, sg.Entries[i].Location.String(), test.expectedLinks[i], sg.Entries)
 				}
 			}
+
+			managerFailures := manager.Failures()
+			if len(managerFailures) != len(test.expectedFailures) {
+				t.Fatalf("received invalid number of failures: got: %d, want: %d\nfailures: %v",
+					len(managerFailures), len(test.expectedFailures), managerFailures)
+			}
+			expectedAttempts := test.expectedAttempts
+			if expectedAttempts == 0 {
+				expectedAttempts = retryPolicy.MaxAttempts
+			}
+			for i := range managerFailures {
+				if managerFailures[i].URL.String() != test.expectedFailures[i] {
+					t.Errorf("received invalid failure(i=%d): got: %q, want: %q",
+						i, managerFailures[i].URL.String(), test.expectedFailures[i])
+				}
+				if managerFailures[i].Attempts != expectedAttempts {
+					t.Errorf("invalid number of attempts for %q: got: %d, want: %d",
+						managerFailures[i].URL.String(), managerFailures[i].Attempts, expectedAttempts)
+				}
+			}
 		})
 	}
 }
+
+func TestManagerRedirects(t *testing.T) {
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/": []string{
+				"https://google.com/1",
+				"https://google.com/external",
+			},
+		},
+		redirects: map[string]string{
+			"https://google.com/1":        "https://google.com/2",
+			"https://google.com/2":        "https://google.com/3",
+			"https://google.com/external": "https://bing.com/",
+		},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), DefaultCrawlOptions(), fetcherCreator, logrus.New())
+	if _, err := manager.SitemapGenerator(context.Background()); err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+
+	redirects := manager.Redirects()
+	if len(redirects) != 2 {
+		t.Fatalf("invalid number of redirect chains: got: %d, want: 2\nredirects: %v", len(redirects), redirects)
+	}
+	if len(redirects[0].Hops) != 2 || redirects[0].Final.String() != "https://google.com/3" || redirects[0].OffSite {
+		t.Errorf("invalid redirect chain: %v", redirects[0])
+	}
+	if len(redirects[1].Hops) != 1 || redirects[1].Final.String() != "https://bing.com/" || !redirects[1].OffSite {
+		t.Errorf("invalid off-site redirect chain: %v", redirects[1])
+	}
+
+	// Redirect target is the next level, so the chain is cut at the maximum depth.
+	options := DefaultCrawlOptions()
+	options.MaxDepth = 2
+	manager = NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), options, fetcherCreator, logrus.New())
+	sg, err := manager.SitemapGenerator(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+	for _, entry := range sg.Entries {
+		if entry.Location.String() == "https://google.com/3" {
+			t.Errorf("redirect target beyond the maximum depth shouldn't be crawled")
+		}
+	}
+}
+
+func TestManagerEvents(t *testing.T) {
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL:            *baseURL,
+		disallowedPrefixes: []string{"/private"},
+		urls: map[string][]string{
+			"https://google.com/": []string{
+				"https://google.com/1",
+				"https://google.com/private",
+				"https://google.com/missing",
+			},
+		},
+		failures: map[string]int{"https://google.com/missing": 10},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	events := make(chan Event, 100)
+	options := DefaultCrawlOptions()
+	options.Events = events
+	retryPolicy := retry.Policy{MaxAttempts: 1}
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retryPolicy, options, fetcherCreator, logrus.New())
+	if _, err := manager.SitemapGenerator(context.Background()); err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+	close(events)
+
+	got := make(map[EventType][]string)
+	var last Event
+	for event := range events {
+		if event.Type == EventProgress {
+			last = event
+			continue
+		}
+		got[event.Type] = append(got[event.Type], event.URL.String())
+	}
+	want := map[EventType][]string{
+		EventDiscovered:    []string{"https://google.com/", "https://google.com/1", "https://google.com/missing"},
+		EventFetched:       []string{"https://google.com/", "https://google.com/1"},
+		EventFailed:        []string{"https://google.com/missing"},
+		EventRobotsSkipped: []string{"https://google.com/private"},
+	}
+	for eventType, urls := range want {
+		sort.Strings(got[eventType])
+		if !reflect.DeepEqual(got[eventType], urls) {
+			t.Errorf("invalid %s events: got: %v, want: %v", eventType, got[eventType], urls)
+		}
+	}
+	if last.Status != StatusComplete || last.Queued != 0 || last.ActiveWorkers != 0 || last.Stats.Fetched != 3 {
+		t.Errorf("invalid final progress event: %+v", last)
+	}
+}
+
+func TestManagerProgressWhileWaiting(t *testing.T) {
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		hanging: map[string]bool{"https://google.com/": true},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	events := make(chan Event, 100)
+	options := DefaultCrawlOptions()
+	options.Timeout = progressInterval + 500*time.Millisecond
+	options.Events = events
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), options, fetcherCreator,
+		logrus.New())
+	if _, err := manager.SitemapGenerator(context.Background()); err == nil {
+		t.Fatalf("crawl should time out")
+	}
+	close(events)
+
+	// The only request doesn't respond, but the progress is published periodically anyway.
+	progress := make([]Event, 0)
+	for event := range events {
+		if event.Type == EventProgress {
+			progress = append(progress, event)
+		}
+	}
+	if len(progress) != 2 {
+		t.Fatalf("expected the periodic and the final progress events, got: %d", len(progress))
+	}
+	if progress[0].Status != StatusRunning || progress[0].ActiveWorkers != 1 {
+		t.Errorf("invalid periodic progress event: %+v", progress[0])
+	}
+	if progress[1].Status != StatusTimedOut {
+		t.Errorf("invalid final progress event: %+v", progress[1])
+	}
+}
+
+func TestManagerCanonicalIssues(t *testing.T) {
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/": []string{
+				"https://google.com/1",
+				"https://google.com/external",
+			},
+		},
+		canonicals: map[string]string{
+			"https://google.com/1":        "https://google.com/2",
+			"https://google.com/2":        "https://google.com/3",
+			"https://google.com/external": "https://bing.com/",
+		},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), DefaultCrawlOptions(), fetcherCreator, logrus.New())
+	sg, err := manager.SitemapGenerator(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+	if len(sg.Entries) != 3 || sg.Entries[1].Location.String() != "https://google.com/3" {
+		t.Errorf("canonical chain should be resolved to the last URL, sitemap: %v", sg.Entries)
+	}
+
+	issues := manager.CanonicalIssues()
+	if len(issues) != 2 {
+		t.Fatalf("invalid number of canonical issues: got: %d, want: 2\nissues: %v", len(issues), issues)
+	}
+	if len(issues[0].Chain) != 3 || issues[0].URL.String() != "https://google.com/1" {
+		t.Errorf("invalid canonical chain: %v", issues[0])
+	}
+	if !issues[1].CrossHost || issues[1].URL.String() != "https://google.com/external" {
+		t.Errorf("invalid cross-host canonical: %v", issues[1])
+	}
+
+	// Canonical is the next level, so the chain is cut at the maximum depth (it's resolved to the last fetched URL).
+	options := DefaultCrawlOptions()
+	options.MaxDepth = 2
+	manager = NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), options, fetcherCreator, logrus.New())
+	if sg, err = manager.SitemapGenerator(context.Background()); err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+	if len(sg.Entries) != 3 || sg.Entries[1].Location.String() != "https://google.com/2" {
+		t.Errorf("canonical beyond the maximum depth shouldn't be crawled, sitemap: %v", sg.Entries)
+	}
+}
+
+func TestManagerPartialResults(t *testing.T) {
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/": []string{"https://google.com/1"},
+		},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), DefaultCrawlOptions(), fetcherCreator, logrus.New())
+	if _, err := manager.SitemapGenerator(ctx); err == nil {
+		t.Errorf("cancelled crawl should fail if partial results are not allowed")
+	}
+
+	options := DefaultCrawlOptions()
+	options.PartialResults = true
+	manager = NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), options, fetcherCreator, logrus.New())
+	sg, err := manager.SitemapGenerator(ctx)
+	if err != nil || sg == nil {
+		t.Fatalf("partial sitemap should be returned, err: %v", err)
+	}
+	if status := manager.Status(); status != StatusCancelled {
+		t.Errorf("invalid crawl status: got: %s, want: %s", status, StatusCancelled)
+	}
+}
+
+func TestManagerSeeds(t *testing.T) {
+	childSitemap, err := sitemap.Compress([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://google.com/from-sitemap</loc></url>
+<url><loc>https://bing.com/</loc></url>
+</urlset>`), sitemap.CompressionGzip)
+	if err != nil {
+		t.Fatalf("couldn't compress sitemap: %s", err)
+	}
+	baseURL, _ := url.Parse("https://google.com/")
+	orphan, _ := url.Parse("https://google.com/orphan")
+	// Seed out of scope isn't crawled.
+	outOfScope, _ := url.Parse("https://bing.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/": []string{},
+			"https://bing.com/":   []string{"https://google.com/from-bing"},
+		},
+		robotsSitemaps: []string{"/sitemap-index.xml"},
+		files: map[string][]byte{
+			"https://google.com/sitemap-index.xml": []byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://google.com/sitemap-1.xml.gz</loc></sitemap>
+<sitemap><loc>https://bing.com/sitemap.xml</loc></sitemap>
+</sitemapindex>`),
+			"https://google.com/sitemap-1.xml.gz": childSitemap,
+			// Sitemap out of scope isn't fetched.
+			"https://bing.com/sitemap.xml": []byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://google.com/from-bing</loc></url>
+</urlset>`),
+		},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	options := DefaultCrawlOptions()
+	options.SeedFromSitemaps = true
+	manager := NewManager([]url.URL{*baseURL, *orphan, *outOfScope}, "crawler-bot", 0, retry.DefaultPolicy(),
+		options, fetcherCreator, logrus.New())
+	sg, err := manager.SitemapGenerator(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't generate sitemap: %s", err)
+	}
+
+	expectedLinks := []string{"https://google.com/", "https://google.com/from-sitemap", "https://google.com/orphan"}
+	if len(sg.Entries) != len(expectedLinks) {
+		t.Fatalf("received invalid number of links: got: %d, want: %d\nsitemap: %v",
+			len(sg.Entries), len(expectedLinks), sg.Entries)
+	}
+	for i := range sg.Entries {
+		if sg.Entries[i].Location.String() != expectedLinks[i] {
+			t.Errorf("received invalid link(i=%d): got: %q, want: %q", i, sg.Entries[i].Location.String(), expectedLinks[i])
+		}
+	}
+}
+
+func TestManagerCheckpoint(t *testing.T) {
+	stateDir, err := ioutil.TempDir("", "crawler-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/":  []string{"https://google.com/1", "https://google.com/2"},
+			"https://google.com/1": []string{"https://google.com/3"},
+			"https://google.com/2": []string{"https://google.com/4"},
+			"https://google.com/3": []string{"https://google.com/1"},
+			"https://google.com/4": []string{},
+		},
+		hanging: map[string]bool{"https://google.com/2": true},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	options := DefaultCrawlOptions()
+	options.Workers = 3
+	options.Timeout = 200 * time.Millisecond
+	options.Queue = QueueOptions{Type: QueueDisk, SegmentSize: 1}
+	options.History.Type = HistoryDisk
+	options.Checkpoint = CheckpointOptions{Dir: stateDir, ID: "test-crawl"}
+	options.CrawlFilter, _ = filter.Parse(nil, []string{"/private/*"})
+
+	// The crawl times out while '/2' is in-flight, its state is saved.
+	manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retry.DefaultPolicy(), options, fetcherCreator,
+		logrus.New())
+	if _, err := manager.SitemapGenerator(context.Background()); err == nil {
+		t.Fatalf("crawl should time out")
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "test-crawl", checkpointFile)); err != nil {
+		t.Fatalf("checkpoint should be saved: %s", err)
+	}
+
+	mf.hanging = nil
+	seeds, err := CheckpointSeeds(stateDir, "test-crawl")
+	if err != nil {
+		t.Fatalf("couldn't read checkpoint seeds: %s", err)
+	}
+	// Saved options might be rejected by the caller.
+	_, err = ResumeOptions(CrawlOptions{
+		Checkpoint:  CheckpointOptions{Dir: stateDir, ID: "test-crawl", Resume: true},
+		ResumeCheck: func(CrawlOptions) error { return errors.New("too many workers") },
+	})
+	if errors.Cause(err) != ErrInvalidCheckpointOptions {
+		t.Errorf("invalid error: got: %v, want: %v", err, ErrInvalidCheckpointOptions)
+	}
+	// Resumed crawl continues with the saved options, but the directories are decided by the caller.
+	resumeOptions, err := ResumeOptions(CrawlOptions{
+		Checkpoint: CheckpointOptions{Dir: stateDir, ID: "test-crawl", Resume: true},
+		Queue:      QueueOptions{Dir: stateDir},
+		History:    HistoryOptions{Dir: stateDir},
+	})
+	if err != nil {
+		t.Fatalf("couldn't read checkpoint options: %s", err)
+	}
+	if resumeOptions.Workers != options.Workers || resumeOptions.Queue.Type != options.Queue.Type ||
+		resumeOptions.History.Type != options.History.Type || len(resumeOptions.CrawlFilter.Exclude) != 1 {
+		t.Errorf("options should be restored, got: %+v", resumeOptions)
+	}
+	if resumeOptions.Queue.Dir != stateDir || resumeOptions.History.Dir != stateDir {
+		t.Errorf("directories should be kept, got: %+v, %+v", resumeOptions.Queue, resumeOptions.History)
+	}
+	manager = NewManager(seeds, "crawler-bot", 0, retry.DefaultPolicy(), resumeOptions, fetcherCreator,
+		logrus.New())
+	sg, err := manager.SitemapGenerator(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't resume the crawl: %s", err)
+	}
+
+	// Pages fetched before the checkpoint aren't fetched again, but they are in the sitemap.
+	expectedLinks := []string{
+		"https://google.com/",
+		"https://google.com/1",
+		"https://google.com/2",
+		"https://google.com/3",
+		"https://google.com/4",
+	}
+	if len(sg.Entries) != len(expectedLinks) {
+		t.Fatalf("received invalid number of links: got: %d, want: %d\nsitemap: %v",
+			len(sg.Entries), len(expectedLinks), sg.Entries)
+	}
+	for i := range sg.Entries {
+		if sg.Entries[i].Location.String() != expectedLinks[i] {
+			t.Errorf("received invalid link(i=%d): got: %q, want: %q", i, sg.Entries[i].Location.String(), expectedLinks[i])
+		}
+	}
+	if stats := manager.Stats(); stats.Fetched != len(expectedLinks) {
+		t.Errorf("each page should be fetched once, got: %d fetches", stats.Fetched)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "test-crawl")); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of the completed crawl should be removed")
+	}
+	if _, err := CheckpointSeeds(stateDir, "test-crawl"); err != ErrCheckpointNotFound {
+		t.Errorf("invalid error: got: %v, want: %v", err, ErrCheckpointNotFound)
+	}
+}
+
+func TestManagerIncremental(t *testing.T) {
+	stateDir, err := ioutil.TempDir("", "crawler-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+
+	baseURL, _ := url.Parse("https://google.com/")
+	mf := &mockFetcher{
+		baseURL: *baseURL,
+		urls: map[string][]string{
+			"https://google.com/":  []string{"https://google.com/1", "https://google.com/2"},
+			"https://google.com/1": []string{"https://google.com/4"},
+			"https://google.com/2": []string{},
+			"https://google.com/4": []string{},
+		},
+		etags: map[string]string{"https://google.com/": `"a"`, "https://google.com/1": `"b"`},
+	}
+	fetcherCreator := func() http.Fetcher {
+		return mf
+	}
+	options := DefaultCrawlOptions()
+	options.Incremental.Path = filepath.Join(stateDir, "pages.json")
+	retryPolicy := retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	crawl := func() (*Manager, map[string]sitemap.Entry) {
+		manager := NewManager([]url.URL{*baseURL}, "crawler-bot", 0, retryPolicy, options, fetcherCreator,
+			logrus.New())
+		sg, err := manager.SitemapGenerator(context.Background())
+		if err != nil {
+			t.Fatalf("couldn't generate sitemap: %s", err)
+		}
+		entries := make(map[string]sitemap.Entry)
+		for _, entry := range sg.Entries {
+			entries[entry.Location.String()] = entry
+		}
+		return manager, entries
+	}
+	crawl()
+
+	// '/' and '/1' respond with 304 (their links are reused), '/2' changed and links to the new page '/3',
+	// '/4' is fetched again (no ETag), but it didn't change. Retry of '/1' still sends its ETag.
+	mf.failures = map[string]int{"https://google.com/1": 1}
+	mf.urls["https://google.com/"] = nil
+	mf.urls["https://google.com/1"] = nil
+	mf.urls["https://google.com/2"] = []string{"https://google.com/3"}
+	mf.urls["https://google.com/3"] = []string{}
+	manager, entries := crawl()
+
+	for _, u := range []string{"https://google.com/", "https://google.com/1", "https://google.com/2",
+		"https://google.com/3", "https://google.com/4"} {
+		if _, ok := entries[u]; !ok {
+			t.Errorf("url '%s' should be in the sitemap, got: %v", u, entries)
+		}
+	}
+	if stats := manager.Stats(); stats.NotModified != 2 || stats.Unchanged != 1 {
+		t.Errorf("invalid stats: not modified: %d, unchanged: %d", stats.NotModified, stats.Unchanged)
+	}
+	if entries["https://google.com/2"].LastModified.IsZero() {
+		t.Errorf("lastmod of the changed page should be updated")
+	}
+	for _, u := range []string{"https://google.com/", "https://google.com/4"} {
+		if !entries[u].LastModified.IsZero() {
+			t.Errorf("lastmod of the unchanged page '%s' should be kept, got: %s", u, entries[u].LastModified)
+		}
+	}
+}
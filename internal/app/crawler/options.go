@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler/filter"
+	"github.com/mwarzynski/crawler/internal/app/crawler/history"
+	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
+	"github.com/mwarzynski/crawler/internal/app/crawler/queue"
+)
+
+// CrawlOptions configure a single crawl (different sites might need different settings). They are saved
+// in the checkpoints (except for the Checkpoint and Events), so the resumed crawl continues with the same settings.
+type CrawlOptions struct {
+	// Workers is the number of processors fetching the pages concurrently.
+	Workers int
+	// MaxPages is the maximum number of pages to fetch (0 means unlimited).
+	MaxPages int
+	// MaxDepth is the maximum number of links between the seed URL and the page (0 means unlimited).
+	MaxDepth int
+	// Timeout is the maximum duration of the whole crawl.
+	Timeout time.Duration
+	// PartialResults allows to return the sitemap of the crawl which was cancelled or timed out.
+	PartialResults bool
+	// RequestTimeout is the maximum duration of a single request (0 means the fetcher's default).
+	RequestTimeout time.Duration
+	// URLNormalization decides which GET params are kept in the URLs.
+	URLNormalization url_extractor.NormalizationPolicy
+	// SeedFromSitemaps adds the URLs listed in the site's sitemaps (including sitemap indexes and sitemaps
+	// declared in robots.txt) to the seeds.
+	SeedFromSitemaps bool
+	// Scope decides which hosts belong to the crawled site.
+	Scope Scope
+	// CrawlFilter decides which URLs are crawled (seed URL is always crawled).
+	CrawlFilter filter.Filter
+	// SitemapFilter decides which of the crawled URLs are listed in the sitemap.
+	SitemapFilter filter.Filter
+	// Queue decides where the URLs waiting to be crawled are stored.
+	Queue QueueOptions
+	// History decides where the URLs which were already processed are stored.
+	History HistoryOptions
+	// Checkpoint decides if and where the state of the crawl is saved, so it might be resumed.
+	Checkpoint CheckpointOptions `json:"-"`
+	// Incremental reuses the state of the previous crawl of the site.
+	Incremental IncrementalOptions
+	// Traps limit the crawl of the sites generating infinite number of pages.
+	Traps TrapLimits
+	// Events receives the progress of the crawl (nil disables the events). Manager never blocks on the channel,
+	// events are dropped if the receiver doesn't keep up (it should be buffered). The channel isn't closed.
+	Events chan<- Event `json:"-"`
+	// ResumeCheck validates the options restored from the checkpoint of the resumed crawl (e.g. the limits
+	// of the server), nil accepts any options.
+	ResumeCheck func(CrawlOptions) error `json:"-"`
+}
+
+// QueueType is the implementation of the crawl frontier.
+type QueueType string
+
+const (
+	// QueueMemory keeps the URLs in the memory (the fastest option for small sites).
+	QueueMemory QueueType = "memory"
+	// QueueRing keeps the URLs in the memory, but releases the memory of the processed URLs.
+	QueueRing QueueType = "ring"
+	// QueueDisk keeps the URLs on disk, so the memory usage is bounded (for very large sites).
+	QueueDisk QueueType = "disk"
+)
+
+func ParseQueueType(v string) (QueueType, error) {
+	switch t := QueueType(v); t {
+	case QueueMemory, QueueRing, QueueDisk:
+		return t, nil
+	default:
+		return "", errors.Errorf("unsupported queue type '%s'", v)
+	}
+}
+
+// QueueOptions configure the crawl frontier.
+type QueueOptions struct {
+	Type QueueType
+	// Dir is the directory of the disk queue files (system temporary directory if empty).
+	Dir string
+	// SegmentSize is the number of URLs kept in a single file of the disk queue.
+	// Disk queue keeps at most 2 * SegmentSize URLs in the memory.
+	SegmentSize int
+}
+
+func newQueue(options QueueOptions) (queue.FIFO, error) {
+	switch options.Type {
+	case QueueRing:
+		return queue.NewFIFORing(100), nil
+	case QueueDisk:
+		return queue.NewFIFODisk(options.Dir, options.SegmentSize)
+	default:
+		return queue.NewFIFOSlice(100), nil
+	}
+}
+
+// HistoryType is the implementation of the processed URLs history.
+type HistoryType string
+
+const (
+	// HistoryMemory keeps the URLs in the memory (exact, but the memory usage grows with the length of URLs).
+	HistoryMemory HistoryType = "memory"
+	// HistoryBloom keeps the URLs in the scalable Bloom filter (a few bytes per URL, but some new URLs
+	// might be reported as processed and skipped).
+	HistoryBloom HistoryType = "bloom"
+	// HistoryDisk keeps the URLs in the on-disk hash table, so the memory usage is constant (for very large sites).
+	HistoryDisk HistoryType = "disk"
+)
+
+func ParseHistoryType(v string) (HistoryType, error) {
+	switch t := HistoryType(v); t {
+	case HistoryMemory, HistoryBloom, HistoryDisk:
+		return t, nil
+	default:
+		return "", errors.Errorf("unsupported history type '%s'", v)
+	}
+}
+
+// HistoryOptions configure the history of the processed URLs.
+type HistoryOptions struct {
+	Type HistoryType
+	// Capacity is the expected number of URLs (Bloom filter and disk table grow if it's exceeded).
+	Capacity int
+	// FalsePositiveRate is the maximum probability that the Bloom filter skips a new URL.
+	FalsePositiveRate float64
+	// Dir is the directory of the disk history files (system temporary directory if empty).
+	Dir string
+}
+
+func newHistory(options HistoryOptions) (history.History, error) {
+	switch options.Type {
+	case HistoryBloom:
+		return history.NewBloom(options.Capacity, options.FalsePositiveRate)
+	case HistoryDisk:
+		return history.NewDisk(options.Dir, options.Capacity)
+	default:
+		return history.NewMap(), nil
+	}
+}
+
+func DefaultCrawlOptions() CrawlOptions {
+	return CrawlOptions{
+		Workers:          10,
+		Timeout:          10 * time.Minute,
+		RequestTimeout:   time.Minute,
+		URLNormalization: url_extractor.DefaultNormalizationPolicy(),
+		Scope:            Scope{Mode: ScopeHost},
+		Queue:            QueueOptions{Type: QueueMemory, SegmentSize: 10000},
+		History:          HistoryOptions{Type: HistoryMemory, Capacity: 100000, FalsePositiveRate: 0.001},
+		Checkpoint:       CheckpointOptions{Interval: 30 * time.Second},
+		Traps:            DefaultTrapLimits(),
+	}
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
+)
+
+// IncrementalOptions configure the incremental recrawl. Pages fetched by the previous crawl are requested
+// conditionally and the links of the pages which didn't change (304 Not Modified) are reused. Sitemap lastmod
+// is updated only for the pages which really changed (content hash differs).
+type IncrementalOptions struct {
+	// Enabled turns on the incremental mode. Service stores the state of the pages in its state directory,
+	// unless the Path is set.
+	Enabled bool
+	// Path is the file with the state of the pages (ETags, Last-Modified values, content hashes and links).
+	// It's read when the crawl starts (if it exists) and replaced when the crawl is complete.
+	Path string
+}
+
+// pageState is what we know about the page fetched by the crawl.
+type pageState struct {
+	Entry checkpointEntry
+	// ETag and LastModified are the validators of the conditional request.
+	ETag         string
+	LastModified string
+	// ContentHash is the SHA-256 hash of the page body.
+	ContentHash string
+	Links       []string
+	Canonical   string `json:",omitempty"`
+}
+
+// pages keeps the state of the pages fetched by the previous crawl and by the current one.
+type pages struct {
+	previous map[string]pageState
+	current  map[string]pageState
+}
+
+func newPages() *pages {
+	return &pages{
+		previous: make(map[string]pageState),
+		current:  make(map[string]pageState),
+	}
+}
+
+// Load reads the state saved by the previous crawl (missing file means there was no previous crawl).
+func (p *pages) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "opening pages state")
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var state pageState
+		if err := decoder.Decode(&state); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "reading pages state '%s'", path)
+		}
+		p.previous[state.Entry.Location] = state
+	}
+}
+
+// pagesSaveMu serializes the replacements of the pages state, so concurrent crawls of the same site don't clash.
+var pagesSaveMu sync.Mutex
+
+// Save replaces the file with the state of the pages fetched by the current crawl (one JSON object per line).
+// The state is written to a unique temporary file in the same directory first, so the replacement is atomic.
+func (p *pages) Save(path string) error {
+	pagesSaveMu.Lock()
+	defer pagesSaveMu.Unlock()
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "creating pages state")
+	}
+	tmp := f.Name()
+	f.Close()
+	err = writeFileSync(tmp, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, state := range p.current {
+			if err := encoder.Encode(state); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "saving pages state")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "replacing pages state")
+	}
+	return nil
+}
+
+// Validators returns the validators of the page fetched by the previous crawl.
+func (p *pages) Validators(u url.URL) http.Validators {
+	state, ok := p.previous[u.String()]
+	if !ok {
+		return http.Validators{}
+	}
+	return http.Validators{ETag: state.ETag, LastModified: state.LastModified}
+}
+
+func (p *pages) Previous(u url.URL) (pageState, bool) {
+	state, ok := p.previous[u.String()]
+	return state, ok
+}
+
+func (p *pages) Set(state pageState) {
+	p.current[state.Entry.Location] = state
+}
+
+// Unchanged checks if the page was fetched by the previous crawl and its content is the same.
+func (p *pages) Unchanged(u url.URL, contentHash string) bool {
+	state, ok := p.previous[u.String()]
+	return ok && state.ContentHash == contentHash
+}
+
+// lastModified decides the lastmod of the page in the incremental mode: the previous value is kept if the content
+// didn't change. Otherwise, the modification time of the page is used (or the time of the crawl if it's unknown).
+func (p *pages) lastModified(result jobResult, now time.Time) time.Time {
+	previous, ok := p.previous[result.job.url.String()]
+	switch {
+	case !ok:
+		return result.lastModified
+	case p.Unchanged(result.job.url, result.contentHash):
+		return previous.Entry.LastModified
+	case !result.lastModified.IsZero():
+		return result.lastModified
+	default:
+		return now
+	}
+}
+
+func newPageState(entry sitemap.Entry, result jobResult) pageState {
+	state := pageState{
+		Entry:        newCheckpointEntry(entry),
+		ETag:         result.etag,
+		LastModified: result.lastModifiedHeader,
+		ContentHash:  result.contentHash,
+		Links:        make([]string, 0, len(result.urls)),
+	}
+	for _, u := range result.urls {
+		state.Links = append(state.Links, u.String())
+	}
+	if result.canonical != nil {
+		state.Canonical = result.canonical.String()
+	}
+	return state
+}
+
+// links returns the outgoing links and the canonical URL of the page (invalid URLs are skipped).
+func (s pageState) links() ([]url.URL, *url.URL) {
+	links := make([]url.URL, 0, len(s.Links))
+	for _, link := range s.Links {
+		if u, err := url.Parse(link); err == nil {
+			links = append(links, *u)
+		}
+	}
+	if s.Canonical == "" {
+		return links, nil
+	}
+	canonical, err := url.Parse(s.Canonical)
+	if err != nil {
+		return links, nil
+	}
+	return links, canonical
+}
@@ -0,0 +1,96 @@
+package politeness
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Scheduler makes sure we don't send requests to the same host more often than once per the configured delay.
+// It's shared by all processors, so the limit applies to the whole crawl (not to a single worker).
+type Scheduler struct {
+	minDelay time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSchedule
+}
+
+type hostSchedule struct {
+	delay time.Duration
+	next  time.Time
+}
+
+// NewScheduler creates the scheduler which enforces minDelay between requests to a single host.
+func NewScheduler(minDelay time.Duration) *Scheduler {
+	return &Scheduler{
+		minDelay: minDelay,
+		hosts:    make(map[string]*hostSchedule),
+	}
+}
+
+// SetCrawlDelay sets the delay requested by the host (robots.txt Crawl-delay).
+// It's used only if it's greater than the configured minimum delay.
+func (s *Scheduler) SetCrawlDelay(host string, crawlDelay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(host).delay = crawlDelay
+}
+
+// Delay returns the effective delay between requests to the host.
+func (s *Scheduler) Delay(host string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delay(s.host(host))
+}
+
+// RequestsPerSecond returns the effective rate limit for the host (0 means unlimited).
+func (s *Scheduler) RequestsPerSecond(host string) float64 {
+	delay := s.Delay(host)
+	if delay <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(delay)
+}
+
+// Wait blocks until the request to the host might be sent.
+// Each call reserves the next slot, so concurrent callers are served one after another.
+func (s *Scheduler) Wait(ctx context.Context, host string) error {
+	s.mu.Lock()
+	h := s.host(host)
+	now := time.Now()
+	slot := h.next
+	if slot.Before(now) {
+		slot = now
+	}
+	h.next = slot.Add(s.delay(h))
+	s.mu.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) host(host string) *hostSchedule {
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &hostSchedule{}
+		s.hosts[host] = h
+	}
+	return h
+}
+
+func (s *Scheduler) delay(h *hostSchedule) time.Duration {
+	if h.delay > s.minDelay {
+		return h.delay
+	}
+	return s.minDelay
+}
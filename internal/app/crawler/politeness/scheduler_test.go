@@ -0,0 +1,40 @@
+package politeness
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerUsesCrawlDelay(t *testing.T) {
+	scheduler := NewScheduler(time.Millisecond * 10)
+	scheduler.SetCrawlDelay("google.com", time.Millisecond*50)
+
+	if rps := scheduler.RequestsPerSecond("google.com"); rps != 20 {
+		t.Errorf("invalid requests per second for host with crawl delay: got: %f, want: 20", rps)
+	}
+	if rps := scheduler.RequestsPerSecond("bing.com"); rps != 100 {
+		t.Errorf("invalid requests per second for host without crawl delay: got: %f, want: 100", rps)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := scheduler.Wait(context.Background(), "google.com"); err != nil {
+			t.Fatalf("waiting for the slot err: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Errorf("requests were not delayed, elapsed: %s", elapsed)
+	}
+}
+
+func TestSchedulerWaitOnContextCancel(t *testing.T) {
+	scheduler := NewScheduler(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_ = scheduler.Wait(ctx, "google.com")
+	if err := scheduler.Wait(ctx, "google.com"); err != context.Canceled {
+		t.Errorf("wait should return context error, got: %v", err)
+	}
+}
@@ -2,55 +2,139 @@ package crawler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	ohttp "net/http"
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
 	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
+	"github.com/mwarzynski/crawler/internal/app/crawler/politeness"
 	"github.com/mwarzynski/crawler/pkg/logging"
 )
 
 type processor struct {
-	fetcher      http.Fetcher
-	urlExtractor *url_extractor.HTMLParse
-	baseURL      url.URL
-	log          logging.Logger
+	fetcher        http.Fetcher
+	scheduler      *politeness.Scheduler
+	urlExtractor   *url_extractor.HTMLParse
+	requestTimeout time.Duration
+	baseURL        url.URL
+	log            logging.Logger
 }
 
 func newProcessor(
 	fetcher http.Fetcher,
+	scheduler *politeness.Scheduler,
+	normalization url_extractor.NormalizationPolicy,
+	requestTimeout time.Duration,
 	baseURL url.URL,
 	log logging.Logger,
 ) *processor {
 	return &processor{
-		fetcher:      fetcher,
-		urlExtractor: url_extractor.NewHTMLParse(),
-		baseURL:      baseURL,
-		log:          logging.WithFields(log, "crawler", "processor"),
+		fetcher:        fetcher,
+		scheduler:      scheduler,
+		urlExtractor:   url_extractor.NewHTMLParse(normalization),
+		requestTimeout: requestTimeout,
+		baseURL:        baseURL,
+		log:            logging.WithFields(log, "crawler", "processor"),
 	}
 }
 
 func (p *processor) processJob(ctx context.Context, j job) jobResult {
-	body, statusCode, err := p.fetcher.Fetch(ctx, j.url)
+	if err := p.scheduler.Wait(ctx, j.url.Host); err != nil {
+		return jobResult{
+			job: j,
+			err: errors.Wrap(err, "waiting for the request slot"),
+		}
+	}
+	resp, err := p.fetch(ctx, j.url, http.FetchOptions{Validators: j.validators})
+	if resp == nil {
+		return jobResult{
+			job: j,
+			err: errors.Wrapf(err, "couldn't fetch '%s'", j.url.String()),
+		}
+	}
+	if location := resp.Header.Get("Location"); http.IsRedirect(resp.StatusCode) && location != "" {
+		target, err := p.urlExtractor.ResolveURL(j.url, location)
+		if err != nil {
+			return jobResult{
+				job:        j,
+				statusCode: resp.StatusCode,
+				err:        errors.Wrapf(err, "invalid redirect location '%s'", location),
+			}
+		}
+		return jobResult{
+			job:        j,
+			statusCode: resp.StatusCode,
+			redirect:   &target,
+		}
+	}
+	if resp.StatusCode == ohttp.StatusNotModified {
+		return jobResult{
+			job:         j,
+			statusCode:  resp.StatusCode,
+			notModified: true,
+		}
+	}
 	if err != nil {
+		retryAfter, _ := http.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
 		return jobResult{
-			statusCode: statusCode,
+			job:        j,
+			statusCode: resp.StatusCode,
+			retryAfter: retryAfter,
 			err:        errors.Wrapf(err, "couldn't fetch '%s'", j.url.String()),
 		}
 	}
-	urls, err := p.urlExtractor.ExtractURLs(j.url, body)
+	page, err := p.urlExtractor.ExtractPage(j.url, resp.Body)
 	if err != nil {
 		return jobResult{
-			statusCode: statusCode,
+			job:        j,
+			statusCode: resp.StatusCode,
 			err:        errors.Wrap(err, "couldn't extract urls from body"),
 		}
 	}
+	contentHash := sha256.Sum256(resp.Body)
 	return jobResult{
-		urls:       urls,
-		statusCode: statusCode,
-		err:        nil,
+		job:                j,
+		urls:               page.URLs,
+		statusCode:         resp.StatusCode,
+		title:              page.Title,
+		alternates:         page.Alternates,
+		canonical:          page.Canonical,
+		lastModified:       lastModified(resp, page),
+		etag:               resp.Header.Get("ETag"),
+		lastModifiedHeader: resp.Header.Get("Last-Modified"),
+		contentHash:        hex.EncodeToString(contentHash[:]),
+		err:                nil,
+	}
+}
+
+// fetch fetches the URL within the request timeout. Timed out request is reported as http.ErrRequestTimeout,
+// so it's not mistaken for the end of the crawl (context errors aren't retried).
+func (p *processor) fetch(ctx context.Context, u url.URL, options http.FetchOptions) (*http.Response, error) {
+	if p.requestTimeout <= 0 {
+		return p.fetcher.Fetch(ctx, u, options)
+	}
+	requestCtx, cancel := context.WithTimeout(ctx, p.requestTimeout)
+	defer cancel()
+	resp, err := p.fetcher.Fetch(requestCtx, u, options)
+	if err != nil && ctx.Err() == nil && requestCtx.Err() == context.DeadlineExceeded {
+		return resp, http.ErrRequestTimeout
+	}
+	return resp, err
+}
+
+// lastModified prefers the Last-Modified header over the modification time declared in the document.
+func lastModified(resp *http.Response, page *url_extractor.Page) time.Time {
+	if header := resp.Header.Get("Last-Modified"); header != "" {
+		if t, err := ohttp.ParseTime(header); err == nil {
+			return t
+		}
 	}
+	return page.ModifiedTime
 }
 
 func (p *processor) Run(ctx context.Context, jobs <-chan job, jobResults chan<- jobResult) <-chan struct{} {
@@ -60,7 +144,11 @@ func (p *processor) Run(ctx context.Context, jobs <-chan job, jobResults chan<-
 			select {
 			case job := <-jobs:
 				result := p.processJob(ctx, job)
-				jobResults <- result
+				select {
+				case jobResults <- result:
+				case <-ctx.Done():
+					// Manager doesn't receive the results anymore.
+				}
 			case <-ctx.Done():
 				p.log.Debug("processor exited (ctx.Done)")
 				close(done)
@@ -2,11 +2,15 @@ package crawler
 
 import (
 	"context"
+	ohttp "net/http"
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
+	"github.com/mwarzynski/crawler/internal/app/crawler/politeness"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,7 +24,7 @@ func TestProcessorOnContextCancel(t *testing.T) {
 		return nil
 	}
 	u, _ := url.Parse("https://google.com")
-	processor := newProcessor(fetcherCreator(), *u, log)
+	processor := newProcessor(fetcherCreator(), politeness.NewScheduler(0), url_extractor.DefaultNormalizationPolicy(), 0, *u, log)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -44,3 +48,44 @@ func TestProcessorOnContextCancel(t *testing.T) {
 		t.Errorf("processor didn't finish after context cancel")
 	}
 }
+
+type fetcherFunc func(ctx context.Context, url url.URL) (*http.Response, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, url url.URL, _ http.FetchOptions) (*http.Response, error) {
+	return f(ctx, url)
+}
+
+func TestProcessorLastModified(t *testing.T) {
+	body := []byte(`<html><head><meta property="article:modified_time" content="2019-06-01T10:00:00Z"></head></html>`)
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"header takes precedence over metadata", "Mon, 01 Jul 2019 10:00:00 GMT", "2019-07-01T10:00:00Z"},
+		{"metadata is used without header", "", "2019-06-01T10:00:00Z"},
+		{"metadata is used if header is invalid", "yesterday", "2019-06-01T10:00:00Z"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := fetcherFunc(func(ctx context.Context, u url.URL) (*http.Response, error) {
+				header := make(ohttp.Header)
+				if test.header != "" {
+					header.Set("Last-Modified", test.header)
+				}
+				return &http.Response{Body: body, StatusCode: ohttp.StatusOK, Header: header, URL: u}, nil
+			})
+			u, _ := url.Parse("https://google.com/")
+			processor := newProcessor(fetcher, politeness.NewScheduler(0), url_extractor.DefaultNormalizationPolicy(),
+				0, *u, logrus.New())
+
+			result := processor.processJob(context.Background(), job{url: *u})
+			if result.err != nil {
+				t.Fatalf("processing job: %s", result.err)
+			}
+			if got := result.lastModified.UTC().Format(time.RFC3339); got != test.expected {
+				t.Errorf("invalid last modified: got: %s, want: %s", got, test.expected)
+			}
+		})
+	}
+}
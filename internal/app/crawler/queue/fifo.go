@@ -1,8 +1,57 @@
 package queue
 
-import "net/url"
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Item is the URL waiting to be crawled.
+type Item struct {
+	URL url.URL
+	// Depth is the number of links between the seed URL and the URL.
+	Depth int
+}
+
+// MarshalText serializes the item as 'depth url' (used by the disk queue and the crawl checkpoints).
+func (i Item) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(i.Depth) + " " + i.URL.String()), nil
+}
+
+func (i *Item) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), " ", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid item '%s'", text)
+	}
+	depth, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return errors.Wrapf(err, "invalid depth '%s'", parts[0])
+	}
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return errors.Wrapf(err, "invalid url '%s'", parts[1])
+	}
+	i.URL, i.Depth = *u, depth
+	return nil
+}
 
 type FIFO interface {
-	Push(v url.URL)
-	Pop() (url.URL, bool)
+	Push(v Item)
+	Pop() (Item, bool)
+	Len() int
+	// Save writes the queued items in order, one per line (see Item.MarshalText). Queue isn't modified.
+	Save(w io.Writer) error
+}
+
+func writeItems(w io.Writer, items []Item) error {
+	for _, item := range items {
+		text, _ := item.MarshalText()
+		if _, err := w.Write(append(text, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
 }
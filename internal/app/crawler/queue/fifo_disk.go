@@ -0,0 +1,207 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FIFODisk is the queue which keeps most of its items on disk, so the memory usage is bounded regardless of
+// the queue length. Pushed items are collected in the in-memory tail buffer which is written to a new
+// append-only segment file when it's full. Items are popped from the in-memory head buffer which is loaded
+// from the oldest segment (segment file is removed afterwards). At most 2 * segmentSize items are kept in memory.
+type FIFODisk struct {
+	dir         string
+	segmentSize int
+
+	head     []Item
+	tail     []Item
+	segments []segment
+	// nextSegment is the sequence number of the next segment file.
+	nextSegment int
+	length      int
+	err         error
+}
+
+// maxLineLength is the maximum length of the serialized item (URLs are rarely longer than a few KB).
+const maxLineLength = 1024 * 1024
+
+// segment is the file with the items written at once.
+type segment struct {
+	name   string
+	length int
+}
+
+// NewFIFODisk creates the queue storing its segments in a new temporary directory inside the dir
+// (system temporary directory if dir is empty). The directory is removed by Close.
+func NewFIFODisk(dir string, segmentSize int) (*FIFODisk, error) {
+	if segmentSize < 1 {
+		return nil, errors.Errorf("invalid segment size %d", segmentSize)
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "creating directory '%s'", dir)
+		}
+	}
+	segmentsDir, err := ioutil.TempDir(dir, "queue-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating segments directory")
+	}
+	return &FIFODisk{
+		dir:         segmentsDir,
+		segmentSize: segmentSize,
+		head:        make([]Item, 0, segmentSize),
+		tail:        make([]Item, 0, segmentSize),
+	}, nil
+}
+
+func (q *FIFODisk) Push(v Item) {
+	q.tail = append(q.tail, v)
+	q.length++
+	if len(q.tail) < q.segmentSize {
+		return
+	}
+	if err := q.writeSegment(); err != nil {
+		// Items are kept in memory, so nothing is lost (but the memory usage isn't bounded anymore).
+		q.setErr(err)
+	}
+}
+
+func (q *FIFODisk) Pop() (Item, bool) {
+	if len(q.head) == 0 {
+		q.loadHead()
+	}
+	if len(q.head) == 0 {
+		return Item{}, false
+	}
+	v := q.head[0]
+	q.head[0] = Item{}
+	q.head = q.head[1:]
+	q.length--
+	return v, true
+}
+
+func (q *FIFODisk) Len() int {
+	return q.length
+}
+
+// Err returns the first error of the disk operation. Failed writes keep the items in memory,
+// failed reads lose the items of the segment.
+func (q *FIFODisk) Err() error {
+	return q.err
+}
+
+// Save writes the head buffer, the segments (files are copied as they are, items have the same format)
+// and the tail buffer.
+func (q *FIFODisk) Save(w io.Writer) error {
+	if err := writeItems(w, q.head); err != nil {
+		return err
+	}
+	for _, s := range q.segments {
+		if err := copySegment(w, s.name); err != nil {
+			return err
+		}
+	}
+	return writeItems(w, q.tail)
+}
+
+// Close removes the segment files.
+func (q *FIFODisk) Close() error {
+	q.head, q.tail, q.segments, q.length = nil, nil, nil, 0
+	return errors.Wrap(os.RemoveAll(q.dir), "removing segments directory")
+}
+
+func (q *FIFODisk) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// loadHead loads the next items into the head buffer: the oldest segment or (if there are no segments)
+// the tail buffer.
+func (q *FIFODisk) loadHead() {
+	for len(q.segments) > 0 {
+		s := q.segments[0]
+		q.segments = q.segments[1:]
+		items, err := readSegment(s.name)
+		if removeErr := os.Remove(s.name); removeErr != nil {
+			q.setErr(errors.Wrapf(removeErr, "removing segment '%s'", s.name))
+		}
+		if err != nil {
+			q.length -= s.length
+			q.setErr(err)
+			continue
+		}
+		q.head = items
+		return
+	}
+	q.head, q.tail = q.tail, q.head[:0]
+}
+
+func (q *FIFODisk) writeSegment() error {
+	name := filepath.Join(q.dir, fmt.Sprintf("segment-%08d", q.nextSegment))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "creating segment '%s'", name)
+	}
+	w := bufio.NewWriter(f)
+	for _, item := range q.tail {
+		text, _ := item.MarshalText()
+		if _, err := fmt.Fprintf(w, "%s\n", text); err != nil {
+			f.Close()
+			os.Remove(name)
+			return errors.Wrapf(err, "writing segment '%s'", name)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(name)
+		return errors.Wrapf(err, "writing segment '%s'", name)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return errors.Wrapf(err, "closing segment '%s'", name)
+	}
+	q.nextSegment++
+	q.segments = append(q.segments, segment{name: name, length: len(q.tail)})
+	q.tail = q.tail[:0]
+	return nil
+}
+
+func copySegment(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.Wrapf(err, "opening segment '%s'", name)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return errors.Wrapf(err, "copying segment '%s'", name)
+}
+
+func readSegment(name string) ([]Item, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening segment '%s'", name)
+	}
+	defer f.Close()
+
+	items := make([]Item, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	for scanner.Scan() {
+		var item Item
+		if err := item.UnmarshalText(scanner.Bytes()); err != nil {
+			return nil, errors.Wrapf(err, "reading segment '%s'", name)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "reading segment '%s'", name)
+	}
+	return items, nil
+}
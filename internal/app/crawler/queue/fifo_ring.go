@@ -0,0 +1,71 @@
+package queue
+
+import "io"
+
+// FIFORing is the in-memory queue backed by the ring buffer. Unlike FIFOSlice, it reuses the space of popped
+// items and shrinks the buffer when most of it is unused.
+type FIFORing struct {
+	buffer []Item
+	head   int
+	length int
+	// minCapacity is the capacity the buffer never shrinks below.
+	minCapacity int
+}
+
+func NewFIFORing(initCapacity uint) *FIFORing {
+	capacity := int(initCapacity)
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &FIFORing{
+		buffer:      make([]Item, capacity),
+		minCapacity: capacity,
+	}
+}
+
+func (q *FIFORing) Push(v Item) {
+	if q.length == len(q.buffer) {
+		q.resize(2 * len(q.buffer))
+	}
+	q.buffer[(q.head+q.length)%len(q.buffer)] = v
+	q.length++
+}
+
+func (q *FIFORing) Pop() (Item, bool) {
+	if q.length == 0 {
+		return Item{}, false
+	}
+	v := q.buffer[q.head]
+	// Release the references, so the popped URL might be garbage collected.
+	q.buffer[q.head] = Item{}
+	q.head = (q.head + 1) % len(q.buffer)
+	q.length--
+	if q.length < len(q.buffer)/4 && len(q.buffer)/2 >= q.minCapacity {
+		q.resize(len(q.buffer) / 2)
+	}
+	return v, true
+}
+
+func (q *FIFORing) Len() int {
+	return q.length
+}
+
+func (q *FIFORing) Save(w io.Writer) error {
+	end := q.head + q.length
+	if end <= len(q.buffer) {
+		return writeItems(w, q.buffer[q.head:end])
+	}
+	if err := writeItems(w, q.buffer[q.head:]); err != nil {
+		return err
+	}
+	return writeItems(w, q.buffer[:end-len(q.buffer)])
+}
+
+func (q *FIFORing) resize(capacity int) {
+	buffer := make([]Item, capacity)
+	for i := 0; i < q.length; i++ {
+		buffer[i] = q.buffer[(q.head+i)%len(q.buffer)]
+	}
+	q.buffer = buffer
+	q.head = 0
+}
@@ -2,30 +2,38 @@ package queue
 
 import (
 	"errors"
-	"net/url"
+	"io"
 )
 
 var ErrEmpty = errors.New("queue is empty")
 
 type FIFOSlice struct {
-	queue []url.URL
+	queue []Item
 }
 
 func NewFIFOSlice(initLength uint) *FIFOSlice {
 	return &FIFOSlice{
-		queue: make([]url.URL, 0, int(initLength)),
+		queue: make([]Item, 0, int(initLength)),
 	}
 }
 
-func (q *FIFOSlice) Push(v url.URL) {
+func (q *FIFOSlice) Push(v Item) {
 	q.queue = append(q.queue, v)
 }
 
-func (q *FIFOSlice) Pop() (url.URL, bool) {
+func (q *FIFOSlice) Pop() (Item, bool) {
 	if len(q.queue) == 0 {
-		return url.URL{}, false
+		return Item{}, false
 	}
 	v := q.queue[0]
 	q.queue = q.queue[1:]
 	return v, true
 }
+
+func (q *FIFOSlice) Len() int {
+	return len(q.queue)
+}
+
+func (q *FIFOSlice) Save(w io.Writer) error {
+	return writeItems(w, q.queue)
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func item(i int) Item {
+	u, _ := url.Parse(fmt.Sprintf("https://google.com/%d?q=a%%20b", i))
+	return Item{URL: *u, Depth: i % 3}
+}
+
+func testFIFO(t *testing.T, q FIFO) {
+	// Interleave pushes and pops, so the buffers are reused.
+	pushed, popped := 0, 0
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 25; i++ {
+			q.Push(item(pushed))
+			pushed++
+		}
+		for i := 0; i < 10; i++ {
+			v, ok := q.Pop()
+			if !ok {
+				t.Fatalf("queue should not be empty, len: %d", q.Len())
+			}
+			if expected := item(popped); v.URL.String() != expected.URL.String() || v.Depth != expected.Depth {
+				t.Fatalf("invalid item: got: %v, want: %v", v, expected)
+			}
+			popped++
+		}
+	}
+	if q.Len() != pushed-popped {
+		t.Errorf("invalid length: got: %d, want: %d", q.Len(), pushed-popped)
+	}
+	for q.Len() > 0 {
+		v, _ := q.Pop()
+		if expected := item(popped); v.URL.String() != expected.URL.String() {
+			t.Fatalf("invalid item: got: %v, want: %v", v, expected)
+		}
+		popped++
+	}
+	if _, ok := q.Pop(); ok || popped != pushed {
+		t.Errorf("queue should be empty after popping all %d items", pushed)
+	}
+}
+
+// testFIFOSave checks that the saved items are the queued ones (in order) and the queue isn't modified.
+func testFIFOSave(t *testing.T, q FIFO) {
+	for i := 0; i < 10; i++ {
+		q.Push(item(i))
+	}
+	for i := 0; i < 5; i++ {
+		q.Pop()
+	}
+	for i := 10; i < 30; i++ {
+		q.Push(item(i))
+	}
+	var buf bytes.Buffer
+	if err := q.Save(&buf); err != nil {
+		t.Fatalf("couldn't save queue: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 25 || q.Len() != 25 {
+		t.Fatalf("invalid number of items: saved: %d, queued: %d, want: 25", len(lines), q.Len())
+	}
+	for i, line := range lines {
+		expected := item(i + 5)
+		if text, _ := expected.MarshalText(); line != string(text) {
+			t.Errorf("invalid item(i=%d): got: %q, want: %q", i, line, text)
+		}
+		if v, _ := q.Pop(); v.URL.String() != expected.URL.String() {
+			t.Errorf("queue shouldn't be modified, got: %v, want: %v", v, expected)
+		}
+	}
+}
+
+func TestFIFOSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue-test")
+	if err != nil {
+		t.Fatalf("couldn't create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	disk, err := NewFIFODisk(dir, 8)
+	if err != nil {
+		t.Fatalf("couldn't create queue: %s", err)
+	}
+	defer disk.Close()
+
+	// Ring buffer wraps around after the items are popped.
+	testFIFOSave(t, NewFIFOSlice(1))
+	testFIFOSave(t, NewFIFORing(28))
+	testFIFOSave(t, disk)
+}
+
+func TestFIFOSlice(t *testing.T) {
+	testFIFO(t, NewFIFOSlice(1))
+}
+
+func TestFIFORing(t *testing.T) {
+	q := NewFIFORing(4)
+	testFIFO(t, q)
+	if len(q.buffer) != 4 {
+		t.Errorf("empty queue should shrink to the initial capacity, got: %d", len(q.buffer))
+	}
+}
+
+func TestFIFODisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue-test")
+	if err != nil {
+		t.Fatalf("couldn't create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewFIFODisk(dir, 8)
+	if err != nil {
+		t.Fatalf("couldn't create queue: %s", err)
+	}
+	for i := 0; i < 20; i++ {
+		q.Push(item(i))
+	}
+	if len(q.segments) != 2 || len(q.tail) != 4 {
+		t.Errorf("items should be written to segments, segments: %d, tail: %d", len(q.segments), len(q.tail))
+	}
+	for i := 0; i < 20; i++ {
+		q.Pop()
+	}
+	testFIFO(t, q)
+	if q.Err() != nil {
+		t.Errorf("unexpected error: %s", q.Err())
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("couldn't close queue: %s", err)
+	}
+	if _, err := os.Stat(q.dir); !os.IsNotExist(err) {
+		t.Errorf("segments directory should be removed")
+	}
+}
@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+)
+
+// RedirectHop is a single redirect: URL responded with StatusCode and pointed to the next hop.
+type RedirectHop struct {
+	URL        url.URL
+	StatusCode int
+}
+
+// Redirect describes the chain of redirects.
+type Redirect struct {
+	Hops []RedirectHop
+	// Final is the URL where the chain ends.
+	Final url.URL
+	// Loop is set if the chain points back to one of its hops.
+	Loop bool
+	// OffSite is set if the final URL is not in scope of the crawl (it's excluded from the sitemap).
+	OffSite bool
+}
+
+type redirectTarget struct {
+	location   url.URL
+	statusCode int
+}
+
+// redirects keeps all redirects encountered during the crawl. Each hop is fetched by a separate job,
+// so the chains are assembled from single hops.
+type redirects struct {
+	targets map[string]redirectTarget
+}
+
+func newRedirects() *redirects {
+	return &redirects{
+		targets: make(map[string]redirectTarget),
+	}
+}
+
+func (r *redirects) Add(from url.URL, statusCode int, to url.URL) {
+	r.targets[from.String()] = redirectTarget{
+		location:   to,
+		statusCode: statusCode,
+	}
+}
+
+// Loop checks if following the redirects from the URL leads back to it.
+func (r *redirects) Loop(from url.URL) bool {
+	start := from.String()
+	visited := make(map[string]struct{})
+	current := start
+	for {
+		target, ok := r.targets[current]
+		if !ok {
+			return false
+		}
+		current = target.location.String()
+		if current == start {
+			return true
+		}
+		if _, ok := visited[current]; ok {
+			return false
+		}
+		visited[current] = struct{}{}
+	}
+}
+
+// Chains assembles the redirect chains. Chains start at URLs which are not redirect targets themselves
+// (or at any hop of the loop if there is no such URL).
+func (r *redirects) Chains(inScope func(url.URL) bool) []Redirect {
+	sources := make([]string, 0, len(r.targets))
+	isTarget := make(map[string]bool)
+	for source, target := range r.targets {
+		sources = append(sources, source)
+		isTarget[target.location.String()] = true
+	}
+	sort.Strings(sources)
+
+	chains := make([]Redirect, 0)
+	visited := make(map[string]bool)
+	build := func(start string) {
+		chain := Redirect{}
+		inChain := make(map[string]bool)
+		current := start
+		for {
+			target, ok := r.targets[current]
+			if !ok {
+				break
+			}
+			inChain[current] = true
+			visited[current] = true
+			u, _ := url.Parse(current)
+			chain.Hops = append(chain.Hops, RedirectHop{URL: *u, StatusCode: target.statusCode})
+			chain.Final = target.location
+			current = target.location.String()
+			if inChain[current] {
+				chain.Loop = true
+				break
+			}
+		}
+		chain.OffSite = !chain.Loop && !inScope(chain.Final)
+		chains = append(chains, chain)
+	}
+	for _, source := range sources {
+		if !isTarget[source] {
+			build(source)
+		}
+	}
+	for _, source := range sources {
+		if !visited[source] {
+			build(source)
+		}
+	}
+	return chains
+}
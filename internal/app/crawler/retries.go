@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"time"
+)
+
+type delayedJob struct {
+	job job
+	at  time.Time
+}
+
+// retries stores the jobs that failed and should be processed again, but not earlier than the specified time.
+// Failed jobs don't block the processors, they are scheduled again by the Manager once they are due.
+type retries struct {
+	jobs []delayedJob
+}
+
+func newRetries() *retries {
+	return &retries{}
+}
+
+func (r *retries) Push(j job, at time.Time) {
+	r.jobs = append(r.jobs, delayedJob{job: j, at: at})
+}
+
+// PopDue returns the job which is already due (if any).
+func (r *retries) PopDue(now time.Time) (job, bool) {
+	for i, dj := range r.jobs {
+		if dj.at.After(now) {
+			continue
+		}
+		r.jobs = append(r.jobs[:i], r.jobs[i+1:]...)
+		return dj.job, true
+	}
+	return job{}, false
+}
+
+// Next returns the time when the earliest job will be due.
+func (r *retries) Next() (time.Time, bool) {
+	if len(r.jobs) == 0 {
+		return time.Time{}, false
+	}
+	next := r.jobs[0].at
+	for _, dj := range r.jobs[1:] {
+		if dj.at.Before(next) {
+			next = dj.at
+		}
+	}
+	return next, true
+}
+
+func (r *retries) Len() int {
+	return len(r.jobs)
+}
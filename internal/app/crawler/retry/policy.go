@@ -0,0 +1,74 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Policy describes when and how long after the failed request it should be retried.
+type Policy struct {
+	// MaxAttempts is the maximum number of requests for a single URL (including the first one).
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. Each subsequent retry doubles it.
+	BaseDelay time.Duration
+	// MaxDelay limits the exponential backoff. Retry-After sent by the server may exceed it.
+	MaxDelay time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Second * 30,
+	}
+}
+
+// ShouldRetry checks if the failed request might succeed if we try again.
+// We retry server errors (5xx), rate limiting (429) and transport errors (no status code).
+// Requests interrupted because the crawl was cancelled or timed out (context errors) aren't retried.
+func (p Policy) ShouldRetry(attempt int, statusCode int, err error) bool {
+	if attempt+1 >= p.MaxAttempts || isContextError(err) {
+		return false
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return true
+	case statusCode >= http.StatusInternalServerError:
+		return true
+	case statusCode == 0 && err != nil:
+		return true
+	default:
+		return false
+	}
+}
+
+// Backoff returns the delay before the next attempt (attempt is 0 for the first request).
+// It's the exponential backoff with jitter, so many URLs failed at the same time won't be retried at once.
+// If the server specified Retry-After, then we wait at least this long.
+func (p Policy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(attempt)))
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// isContextError checks if the error was caused by the cancelled or expired context (HTTP client wraps it
+// in the url.Error).
+func isContextError(err error) bool {
+	err = errors.Cause(err)
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
@@ -0,0 +1,67 @@
+package retry
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPolicyShouldRetry(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	transportErr := errors.New("connection reset by peer")
+	tests := []struct {
+		name       string
+		attempt    int
+		statusCode int
+		err        error
+		retry      bool
+	}{
+		{"server error", 0, http.StatusServiceUnavailable, nil, true},
+		{"rate limiting", 0, http.StatusTooManyRequests, nil, true},
+		{"transport error", 0, 0, transportErr, true},
+		{"not found", 0, http.StatusNotFound, nil, false},
+		{"ok", 0, http.StatusOK, nil, false},
+		{"last attempt", 2, http.StatusServiceUnavailable, nil, false},
+		{"cancelled", 0, 0, errors.Wrap(context.Canceled, "couldn't fetch"), false},
+		{"timed out", 0, 0, context.DeadlineExceeded, false},
+		{"cancelled HTTP request", 0, 0, errors.Wrap(&url.Error{Op: "Get", URL: "/", Err: context.Canceled}, "do"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if retry := policy.ShouldRetry(test.attempt, test.statusCode, test.err); retry != test.retry {
+				t.Errorf("ShouldRetry: got: %t, want: %t", retry, test.retry)
+			}
+		})
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	policy := Policy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"first retry", 0, 0, 500 * time.Millisecond, time.Second},
+		{"exponential", 2, 0, 2 * time.Second, 4 * time.Second},
+		{"capped at max delay", 8, 0, 5 * time.Second, 10 * time.Second},
+		{"overflow is capped", 100, 0, 5 * time.Second, 10 * time.Second},
+		{"retry after exceeds max delay", 0, time.Minute, time.Minute, time.Minute},
+		{"shorter retry after is ignored", 2, time.Millisecond, 2 * time.Second, 4 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Backoff has jitter, so we check it a few times.
+			for i := 0; i < 100; i++ {
+				if delay := policy.Backoff(test.attempt, test.retryAfter); delay < test.min || delay > test.max {
+					t.Fatalf("Backoff: got: %s, want: [%s, %s]", delay, test.min, test.max)
+				}
+			}
+		})
+	}
+}
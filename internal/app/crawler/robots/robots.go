@@ -0,0 +1,273 @@
+package robots
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots Exclusion Protocol (RFC 9309): https://www.rfc-editor.org/rfc/rfc9309.html
+
+const (
+	keyUserAgent = "user-agent"
+	keyAllow     = "allow"
+	keyDisallow  = "disallow"
+	// Crawl-delay is not a part of the RFC 9309, but it's widely used.
+	keyCrawlDelay = "crawl-delay"
+	// Sitemap records are not a part of any group (RFC 9309, 2.2.4).
+	keySitemap = "sitemap"
+
+	userAgentAny = "*"
+
+	// MaxCrawlDelay is the maximum Crawl-delay we respect. Longer delays would stall the crawl until it times out.
+	MaxCrawlDelay = time.Minute
+)
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	userAgents []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Rules are the robots.txt rules that apply to a single crawler (product token).
+type Rules struct {
+	rules       []rule
+	crawlDelay  time.Duration
+	disallowAll bool
+	sitemaps    []string
+}
+
+// AllowAll returns rules which do not restrict crawling at all.
+// It's used if robots.txt is unavailable (4xx status codes).
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+// DisallowAll returns rules which restrict crawling of the whole site.
+// It's used if robots.txt is unreachable (5xx status codes or network errors).
+func DisallowAll() *Rules {
+	return &Rules{disallowAll: true}
+}
+
+// Parse parses the robots.txt body and selects the groups matching the userAgent.
+// If none of the groups match, then groups for '*' are used.
+func Parse(body []byte, userAgent string) *Rules {
+	groups, sitemaps := parseGroups(body)
+	token := productToken(userAgent)
+
+	matched, matchedAny := &Rules{sitemaps: sitemaps}, &Rules{sitemaps: sitemaps}
+	matchedExact := false
+	for _, g := range groups {
+		// Group might list both '*' and our bot, so all its user agents are checked before the group is merged.
+		exact, wildcard := false, false
+		for _, ua := range g.userAgents {
+			if token != "" && productToken(ua) == token {
+				exact = true
+			}
+			if ua == userAgentAny {
+				wildcard = true
+			}
+		}
+		if exact {
+			matched.merge(g)
+			matchedExact = true
+		}
+		if wildcard {
+			matchedAny.merge(g)
+		}
+	}
+	if !matchedExact {
+		return matchedAny
+	}
+	return matched
+}
+
+func (r *Rules) merge(g group) {
+	r.rules = append(r.rules, g.rules...)
+	if g.crawlDelay > r.crawlDelay {
+		r.crawlDelay = g.crawlDelay
+	}
+}
+
+// CrawlDelay returns the minimum delay between consecutive requests requested by the site (0 if not specified).
+// It's capped at MaxCrawlDelay.
+func (r *Rules) CrawlDelay() time.Duration {
+	if r.crawlDelay > MaxCrawlDelay {
+		return MaxCrawlDelay
+	}
+	return r.crawlDelay
+}
+
+// RequestedCrawlDelay returns the Crawl-delay as specified by the site (it might exceed MaxCrawlDelay).
+func (r *Rules) RequestedCrawlDelay() time.Duration {
+	return r.crawlDelay
+}
+
+// Sitemaps returns the URLs of sitemaps listed in the robots.txt.
+func (r *Rules) Sitemaps() []string {
+	return r.sitemaps
+}
+
+// IsAllowed checks if the crawler is allowed to fetch the url.
+// The most specific (the longest) matching rule wins. In case of a tie, Allow rule is used.
+func (r *Rules) IsAllowed(u url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+func parseGroups(body []byte) ([]group, []string) {
+	groups := make([]group, 0)
+	sitemaps := make([]string, 0)
+	var current *group
+	lastWasUserAgent := false
+
+	for _, line := range strings.Split(string(body), "\n") {
+		key, value, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case keyUserAgent:
+			if current == nil || !lastWasUserAgent {
+				groups = append(groups, group{})
+				current = &groups[len(groups)-1]
+			}
+			current.userAgents = append(current.userAgents, strings.ToLower(value))
+			lastWasUserAgent = true
+		case keyAllow, keyDisallow:
+			lastWasUserAgent = false
+			// Rules outside of any group are ignored.
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{
+				allow:   key == keyAllow,
+				pattern: normalizePattern(value),
+			})
+		case keyCrawlDelay:
+			lastWasUserAgent = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case keySitemap:
+			// Sitemap records don't terminate the user-agent lines.
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		default:
+			// Other records don't terminate the user-agent lines.
+		}
+	}
+	return groups, sitemaps
+}
+
+func parseLine(line string) (key, value string, ok bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	value = strings.TrimSpace(line[i+1:])
+	return key, value, key != ""
+}
+
+// productToken extracts the product token from the user agent (e.g. 'crawler-bot/1.0' -> 'crawler-bot').
+func productToken(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(userAgent, "/ "); i >= 0 {
+		userAgent = userAgent[:i]
+	}
+	return strings.ToLower(userAgent)
+}
+
+// normalizePattern percent-encodes the characters which would be encoded in the URL, so the pattern
+// might be compared with the escaped path of the URL.
+func normalizePattern(pattern string) string {
+	var buf strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '%' && i+2 < len(pattern) && isHex(pattern[i+1]) && isHex(pattern[i+2]):
+			buf.WriteByte('%')
+			buf.WriteString(strings.ToUpper(pattern[i+1 : i+3]))
+			i += 2
+		case c >= 0x80 || c <= 0x20:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// match checks if the path matches the pattern. Pattern might contain '*' (any sequence of characters) and
+// '$' at the end (end of the path).
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+
+	// The first part must be a prefix of the path.
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	if len(parts) == 1 {
+		return !anchored || pos == len(path)
+	}
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return len(path)-pos >= len(part) && strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package robots
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+const robotsTXT = `# Example robots.txt
+User-agent: *
+Disallow: /private
+Allow: /private/public
+
+user-agent: crawler-bot
+user-agent: other-bot
+disallow: /admin   # comment
+Crawl-delay: 1.5
+allow: /admin/help$
+Disallow: /*.pdf$
+Disallow: /search?*q=
+Sitemap: https://google.com/sitemap.xml
+
+User-agent: Crawler-Bot
+Disallow: /tmp/
+`
+
+func TestRulesIsAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		url       string
+		allowed   bool
+	}{
+		{"root", "crawler-bot", "https://google.com/", true},
+		{"disallowed prefix", "crawler-bot", "https://google.com/admin/users", false},
+		{"allow with end anchor", "crawler-bot", "https://google.com/admin/help", true},
+		{"allow with end anchor does not match longer path", "crawler-bot", "https://google.com/admin/help/1", false},
+		{"wildcard with end anchor", "crawler-bot", "https://google.com/docs/file.pdf", false},
+		{"wildcard with end anchor does not match", "crawler-bot", "https://google.com/docs/file.pdf.html", true},
+		{"wildcard in query", "crawler-bot", "https://google.com/search?lang=en&q=test", false},
+		{"groups for the same agent are merged", "crawler-bot", "https://google.com/tmp/file", false},
+		{"user agent is case insensitive with version", "Crawler-Bot/1.0", "https://google.com/admin", false},
+		{"specific group replaces '*' group", "crawler-bot", "https://google.com/private", true},
+		{"'*' group for other bots", "unknown-bot", "https://google.com/private", false},
+		{"longest match wins", "unknown-bot", "https://google.com/private/public/1", true},
+		{"'*' group does not contain other rules", "unknown-bot", "https://google.com/admin", true},
+		{"robots.txt is always allowed", "unknown-bot", "https://google.com/robots.txt", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("invalid url '%s': %s", test.url, err)
+			}
+			rules := Parse([]byte(robotsTXT), test.userAgent)
+			if allowed := rules.IsAllowed(*u); allowed != test.allowed {
+				t.Errorf("IsAllowed(%s): got: %t, want: %t", test.url, allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestRulesSharedGroup(t *testing.T) {
+	// Group listing '*' before our bot applies to our bot as its own group (the other '*' groups don't).
+	body := `User-agent: *
+User-agent: crawler-bot
+Disallow: /shared
+
+User-agent: *
+Disallow: /everyone
+`
+	rules := Parse([]byte(body), "crawler-bot")
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://google.com/shared", false},
+		{"https://google.com/everyone", true},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if allowed := rules.IsAllowed(*u); allowed != test.allowed {
+			t.Errorf("IsAllowed(%s): got: %t, want: %t", test.url, allowed, test.allowed)
+		}
+	}
+}
+
+func TestRulesTieIsAllowed(t *testing.T) {
+	rules := Parse([]byte("User-agent: *\nDisallow: /page\nAllow: /page\n"), "crawler-bot")
+	u, _ := url.Parse("https://google.com/page")
+	if !rules.IsAllowed(*u) {
+		t.Errorf("allow rule should be used when rules are equally specific")
+	}
+}
+
+func TestRulesCrawlDelay(t *testing.T) {
+	if delay := Parse([]byte(robotsTXT), "crawler-bot").CrawlDelay(); delay != 1500*time.Millisecond {
+		t.Errorf("invalid crawl delay for crawler-bot: got: %s, want: %s", delay, 1500*time.Millisecond)
+	}
+	if delay := Parse([]byte(robotsTXT), "unknown-bot").CrawlDelay(); delay != 0 {
+		t.Errorf("invalid crawl delay for unknown-bot: got: %s, want: 0", delay)
+	}
+	rules := Parse([]byte("User-agent: *\nCrawl-delay: 86400\n"), "crawler-bot")
+	if delay := rules.CrawlDelay(); delay != MaxCrawlDelay {
+		t.Errorf("invalid capped crawl delay: got: %s, want: %s", delay, MaxCrawlDelay)
+	}
+	if delay := rules.RequestedCrawlDelay(); delay != 24*time.Hour {
+		t.Errorf("invalid requested crawl delay: got: %s, want: %s", delay, 24*time.Hour)
+	}
+}
+
+func TestRulesSitemaps(t *testing.T) {
+	sitemaps := Parse([]byte(robotsTXT+"Sitemap: https://google.com/news.xml.gz\n"), "unknown-bot").Sitemaps()
+	if len(sitemaps) != 2 || sitemaps[0] != "https://google.com/sitemap.xml" || sitemaps[1] != "https://google.com/news.xml.gz" {
+		t.Errorf("invalid sitemaps: %v", sitemaps)
+	}
+}
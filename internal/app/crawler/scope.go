@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ScopeMode decides which hosts belong to the crawled site.
+type ScopeMode string
+
+const (
+	// ScopeHost crawls only the host of the seed URL.
+	ScopeHost ScopeMode = "host"
+	// ScopeWWW crawls the host of the seed URL and its 'www.' alias (e.g. example.com and www.example.com).
+	ScopeWWW ScopeMode = "www"
+	// ScopeSubdomains crawls all subdomains of the registrable domain (e.g. blog.example.com for example.com).
+	ScopeSubdomains ScopeMode = "subdomains"
+	// ScopeHosts crawls the host of the seed URL and the explicitly listed hosts.
+	ScopeHosts ScopeMode = "hosts"
+)
+
+func ParseScopeMode(v string) (ScopeMode, error) {
+	switch m := ScopeMode(v); m {
+	case ScopeHost, ScopeWWW, ScopeSubdomains, ScopeHosts:
+		return m, nil
+	default:
+		return "", errors.Errorf("unsupported scope mode '%s'", v)
+	}
+}
+
+// Scope describes which URLs belong to the crawled site.
+type Scope struct {
+	Mode ScopeMode
+	// Hosts are the additional hosts crawled in the ScopeHosts mode.
+	Hosts []string
+	// StrictScheme disables the scheme equivalence. By default, http and https URLs of the hosts in scope are
+	// treated as the same pages (and fetched with the scheme of the seed URL).
+	StrictScheme bool
+}
+
+// scope checks if the URLs belong to the crawled site: host must be in scope and the path must start
+// with the path of the seed URL.
+type scope struct {
+	Scope
+	base url.URL
+	// domain is the registrable domain of the seed URL (used in ScopeSubdomains mode).
+	domain string
+	hosts  map[string]bool
+}
+
+func newScope(base url.URL, s Scope) *scope {
+	sc := &scope{
+		Scope: s,
+		base:  base,
+		hosts: map[string]bool{strings.ToLower(base.Host): true},
+	}
+	switch s.Mode {
+	case ScopeWWW:
+		sc.hosts[wwwAlias(strings.ToLower(base.Host))] = true
+	case ScopeSubdomains:
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(base.Hostname()); err == nil {
+			sc.domain = domain
+		}
+	case ScopeHosts:
+		for _, host := range s.Hosts {
+			sc.hosts[strings.ToLower(host)] = true
+		}
+	}
+	return sc
+}
+
+// wwwAlias returns 'www.' alias of the host or the host without 'www.' prefix.
+func wwwAlias(host string) string {
+	if strings.HasPrefix(host, "www.") {
+		return strings.TrimPrefix(host, "www.")
+	}
+	return "www." + host
+}
+
+// Canonicalize applies the scheme equivalence: http and https URLs are fetched with the scheme of the seed URL.
+func (s *scope) Canonicalize(u url.URL) url.URL {
+	if s.StrictScheme || !isHTTP(u.Scheme) || !isHTTP(s.base.Scheme) {
+		return u
+	}
+	u.Scheme = s.base.Scheme
+	return u
+}
+
+func (s *scope) Contains(u url.URL) bool {
+	if u.Scheme != s.base.Scheme && (s.StrictScheme || !isHTTP(u.Scheme)) {
+		return false
+	}
+	if !s.containsHost(strings.ToLower(u.Host)) {
+		return false
+	}
+	return strings.HasPrefix(u.EscapedPath(), s.base.EscapedPath())
+}
+
+// ContainsHost checks if the URL is located on the host in scope (regardless of its path).
+func (s *scope) ContainsHost(u url.URL) bool {
+	return isHTTP(u.Scheme) && s.containsHost(strings.ToLower(u.Host))
+}
+
+func (s *scope) containsHost(host string) bool {
+	if s.hosts[host] {
+		return true
+	}
+	if s.Mode != ScopeSubdomains || s.domain == "" {
+		return false
+	}
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+	return hostname == s.domain || strings.HasSuffix(hostname, "."+s.domain)
+}
+
+func isHTTP(scheme string) bool {
+	return scheme == "http" || scheme == "https"
+}
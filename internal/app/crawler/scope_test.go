@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScopeContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		scope    Scope
+		url      string
+		expected bool
+	}{
+		{"same host", "https://example.com/", Scope{Mode: ScopeHost}, "https://example.com/a", true},
+		{"other host", "https://example.com/", Scope{Mode: ScopeHost}, "https://www.example.com/a", false},
+		{"path prefix", "https://example.com/docs/", Scope{Mode: ScopeHost}, "https://example.com/blog/", false},
+		{"http is equivalent to https", "https://example.com/", Scope{Mode: ScopeHost}, "http://example.com/a", true},
+		{
+			name:     "strict scheme",
+			base:     "https://example.com/",
+			scope:    Scope{Mode: ScopeHost, StrictScheme: true},
+			url:      "http://example.com/a",
+			expected: false,
+		},
+		{"other schemes", "https://example.com/", Scope{Mode: ScopeHost}, "ftp://example.com/a", false},
+		{"www alias", "https://example.com/", Scope{Mode: ScopeWWW}, "https://www.example.com/a", true},
+		{"www alias of www host", "https://www.example.com/", Scope{Mode: ScopeWWW}, "https://example.com/a", true},
+		{
+			name:     "www alias does not allow subdomains",
+			base:     "https://example.com/",
+			scope:    Scope{Mode: ScopeWWW},
+			url:      "https://blog.example.com/",
+			expected: false,
+		},
+		{"subdomain", "https://www.example.co.uk/", Scope{Mode: ScopeSubdomains}, "https://blog.example.co.uk/", true},
+		{
+			name:     "registrable domain",
+			base:     "https://www.example.co.uk/",
+			scope:    Scope{Mode: ScopeSubdomains},
+			url:      "https://example.co.uk/",
+			expected: true,
+		},
+		{
+			name:     "other domain with the same suffix",
+			base:     "https://www.example.co.uk/",
+			scope:    Scope{Mode: ScopeSubdomains},
+			url:      "https://badexample.co.uk/",
+			expected: false,
+		},
+		{
+			name:     "listed host",
+			base:     "https://example.com/",
+			scope:    Scope{Mode: ScopeHosts, Hosts: []string{"docs.example.org"}},
+			url:      "https://docs.example.org/",
+			expected: true,
+		},
+		{
+			name:     "host which is not listed",
+			base:     "https://example.com/",
+			scope:    Scope{Mode: ScopeHosts, Hosts: []string{"docs.example.org"}},
+			url:      "https://example.org/",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, _ := url.Parse(test.base)
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("invalid url '%s': %s", test.url, err)
+			}
+			if contains := newScope(*base, test.scope).Contains(*u); contains != test.expected {
+				t.Errorf("Contains(%s): got: %t, want: %t", test.url, contains, test.expected)
+			}
+		})
+	}
+}
+
+func TestScopeCanonicalize(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	u, _ := url.Parse("http://example.com/a")
+	if canonical := newScope(*base, Scope{Mode: ScopeHost}).Canonicalize(*u); canonical.String() != "https://example.com/a" {
+		t.Errorf("http URL should be fetched with https scheme, got: %s", canonical.String())
+	}
+	if canonical := newScope(*base, Scope{StrictScheme: true}).Canonicalize(*u); canonical.String() != "http://example.com/a" {
+		t.Errorf("URL shouldn't be changed with strict scheme, got: %s", canonical.String())
+	}
+}
+
+func TestScopeContainsHost(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/")
+	s := newScope(*base, Scope{Mode: ScopeWWW})
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://example.com/sitemap.xml", true},
+		{"http://www.example.com/sitemap.xml", true},
+		{"https://internal.example.com/sitemap.xml", false},
+		{"http://127.0.0.1/sitemap.xml", false},
+		{"ftp://example.com/sitemap.xml", false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if contains := s.ContainsHost(*u); contains != test.expected {
+			t.Errorf("ContainsHost(%s): got: %t, want: %t", test.url, contains, test.expected)
+		}
+	}
+}
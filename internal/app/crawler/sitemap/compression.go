@@ -0,0 +1,69 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+)
+
+// Extension returns the file name suffix for the compressed files.
+func (c Compression) Extension() string {
+	if c == CompressionGzip {
+		return ".gz"
+	}
+	return ""
+}
+
+// Compress compresses the sitemap. Note that the sitemap limits apply to the uncompressed size.
+func Compress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		buf := bytes.NewBuffer([]byte{})
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, errors.Wrap(err, "gzip write")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "gzip close")
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.Errorf("unsupported compression '%s'", c)
+	}
+}
+
+// gzipMagic are the first bytes of the gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Decompress decompresses the gzip-compressed sitemap, other data is returned as it is.
+// Sitemaps larger than the limit (MaxFileSize) are rejected.
+func Decompress(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "gzip reader")
+	}
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "gzip read")
+	}
+	if len(decompressed) > MaxFileSize {
+		return nil, errors.Errorf("decompressed sitemap exceeds %d bytes", MaxFileSize)
+	}
+	return decompressed, nil
+}
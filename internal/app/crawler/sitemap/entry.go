@@ -1,6 +1,9 @@
 package sitemap
 
-import "net/url"
+import (
+	"net/url"
+	"time"
+)
 
 type Frequency string
 
@@ -11,6 +14,9 @@ const (
 
 type Entry struct {
 	Location        url.URL
+	Title           string
+	LastModified    time.Time
+	Alternates      []Alternate
 	ChangeFrequency Frequency
 	Priority        float64
 }
@@ -1,14 +1,30 @@
 package sitemap
 
-import "github.com/pkg/errors"
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
 
 type Type string
 
 const (
 	TypeXML       Type = "xml"
 	TypePlaintext Type = "plaintext"
+	TypeRSS       Type = "rss"
+	TypeAtom      Type = "atom"
 )
 
+// ParseType validates the sitemap type provided by the user.
+func ParseType(v string) (Type, error) {
+	switch t := Type(v); t {
+	case TypeXML, TypePlaintext, TypeRSS, TypeAtom:
+		return t, nil
+	default:
+		return "", errors.Errorf("unsupported generator type '%s'", v)
+	}
+}
+
 type Generator struct {
 	Entries []Entry
 }
@@ -21,12 +37,30 @@ func (g *Generator) AddEntry(entry Entry) {
 	g.Entries = append(g.Entries, entry)
 }
 
+// SortEntries sorts the entries by location, so the output doesn't depend on the order of processing.
+func (g *Generator) SortEntries() {
+	sort.SliceStable(g.Entries, func(i, j int) bool {
+		return g.Entries[i].Location.String() < g.Entries[j].Location.String()
+	})
+}
+
+// Generate generates the sitemap as a single document (regardless of the limits, see GenerateFiles).
 func (g *Generator) Generate(t Type) ([]byte, error) {
+	return generate(t, g.Entries, hreflangClusters(g.Entries))
+}
+
+// generate generates the document with the entries. Hreflang clusters are computed for all entries of the sitemap,
+// so the alternates stay reciprocal even if the cluster is split into multiple files.
+func generate(t Type, entries []Entry, clusters map[string][]Alternate) ([]byte, error) {
 	switch t {
 	case TypeXML:
-		return generateXML(g.Entries)
+		return generateXML(entries, clusters)
 	case TypePlaintext:
-		return generatePlaintext(g.Entries)
+		return generatePlaintext(entries)
+	case TypeRSS:
+		return generateRSS(entries)
+	case TypeAtom:
+		return generateAtom(entries)
 	default:
 		return nil, errors.Errorf("unsupported generator type '%s'", t)
 	}
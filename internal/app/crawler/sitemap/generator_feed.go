@@ -0,0 +1,141 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Google accepts RSS 2.0 and Atom 1.0 feeds as sitemaps: https://support.google.com/webmasters/answer/183668
+
+const atomXMLNS = "http://www.w3.org/2005/Atom"
+
+// now is used for the Atom 'updated' elements (required) if we don't know the modification time.
+var now = time.Now
+
+type rssRoot struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+}
+
+func generateRSS(entries []Entry) ([]byte, error) {
+	site := feedSite(entries)
+	items := make([]rssItem, 0, len(entries))
+	for _, entry := range entries {
+		item := rssItem{
+			Title: entryTitle(entry),
+			Link:  entry.Location.String(),
+			GUID:  entry.Location.String(),
+		}
+		if !entry.LastModified.IsZero() {
+			item.PubDate = entry.LastModified.Format(time.RFC1123Z)
+		}
+		items = append(items, item)
+	}
+	root := rssRoot{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       site.Host,
+			Link:        site.String(),
+			Description: "Sitemap of " + site.Host,
+			Items:       items,
+		},
+	}
+	data, err := xml.Marshal(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshaling")
+	}
+	return data, nil
+}
+
+func generateAtom(entries []Entry) ([]byte, error) {
+	site := feedSite(entries)
+	generated := now()
+	feedUpdated := latestModification(entries)
+	if feedUpdated.IsZero() {
+		feedUpdated = generated
+	}
+	atomEntries := make([]atomEntry, 0, len(entries))
+	for _, entry := range entries {
+		updated := entry.LastModified
+		if updated.IsZero() {
+			updated = generated
+		}
+		atomEntries = append(atomEntries, atomEntry{
+			ID:      entry.Location.String(),
+			Title:   entryTitle(entry),
+			Link:    atomLink{Href: entry.Location.String()},
+			Updated: updated.Format(time.RFC3339),
+		})
+	}
+	root := atomFeed{
+		XMLNS:   atomXMLNS,
+		ID:      site.String(),
+		Title:   site.Host,
+		Updated: feedUpdated.Format(time.RFC3339),
+		Link:    atomLink{Href: site.String()},
+		Entries: atomEntries,
+	}
+	data, err := xml.Marshal(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshaling")
+	}
+	return data, nil
+}
+
+// feedSite returns the root of the site the entries belong to (feeds require the link to the site).
+func feedSite(entries []Entry) url.URL {
+	if len(entries) == 0 {
+		return url.URL{}
+	}
+	return url.URL{
+		Scheme: entries[0].Location.Scheme,
+		Host:   entries[0].Location.Host,
+		Path:   "/",
+	}
+}
+
+func entryTitle(entry Entry) string {
+	if entry.Title != "" {
+		return entry.Title
+	}
+	return entry.Location.String()
+}
@@ -0,0 +1,45 @@
+package sitemap
+
+import (
+	"testing"
+	"time"
+)
+
+var sitemapRSS = `<rss version="2.0"><channel><title>google.com</title><link>https://google.com/</link><description>Sitemap of google.com</description><item><title>Test &amp; 1</title><link>https://google.com/test1</link><guid>https://google.com/test1</guid><pubDate>Mon, 01 Jul 2019 10:00:00 +0000</pubDate></item><item><title>https://google.com/test2</title><link>https://google.com/test2</link><guid>https://google.com/test2</guid></item></channel></rss>`
+
+var sitemapAtom = `<feed xmlns="http://www.w3.org/2005/Atom"><id>https://google.com/</id><title>google.com</title><updated>2019-07-01T10:00:00Z</updated><link href="https://google.com/"></link><entry><id>https://google.com/test1</id><title>Test &amp; 1</title><link href="https://google.com/test1"></link><updated>2019-07-01T10:00:00Z</updated></entry><entry><id>https://google.com/test2</id><title>https://google.com/test2</title><link href="https://google.com/test2"></link><updated>2019-07-02T00:00:00Z</updated></entry></feed>`
+
+func TestGeneratorFeeds(t *testing.T) {
+	now = func() time.Time {
+		return time.Date(2019, 7, 2, 0, 0, 0, 0, time.UTC)
+	}
+	defer func() { now = time.Now }()
+
+	generator := NewGenerator()
+	lastModified, _ := time.Parse(time.RFC3339, "2019-07-01T10:00:00Z")
+	generator.AddEntry(Entry{
+		Location:     urlFromString("https://google.com/test1"),
+		Title:        "Test & 1",
+		LastModified: lastModified,
+	})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test2")})
+
+	tests := []struct {
+		sitemapType Type
+		expected    string
+	}{
+		{TypeRSS, sitemapRSS},
+		{TypeAtom, sitemapAtom},
+	}
+	for _, test := range tests {
+		t.Run(string(test.sitemapType), func(t *testing.T) {
+			sitemap, err := generator.Generate(test.sitemapType)
+			if err != nil {
+				t.Fatalf("generating sitemap err: %s", err)
+			}
+			if string(sitemap) != test.expected {
+				t.Errorf("invalid sitemap:\n%s", string(sitemap))
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of a single sitemap file: https://www.sitemaps.org/protocol.html#index
+const (
+	MaxEntriesPerFile = 50000
+	MaxFileSize       = 50 * 1024 * 1024
+)
+
+// ErrTooLarge is returned if the sitemap doesn't fit into a single file (it must be split, see GenerateFiles).
+var ErrTooLarge = errors.Errorf("sitemap exceeds the limits of a single file (%d URLs, %dMB)",
+	MaxEntriesPerFile, MaxFileSize/1024/1024)
+
+// File is a single named sitemap document.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// FilesOptions configures how the sitemap is split into files.
+type FilesOptions struct {
+	// BaseURL is the location where the files are going to be hosted. It's used for child sitemap locations
+	// in the sitemap index.
+	BaseURL url.URL
+	// Name is the name of the main file without extension (default: 'sitemap'). Child sitemaps are numbered,
+	// e.g. 'sitemap-1.xml'.
+	Name string
+	// MaxEntries limits the number of entries in a single file (default: MaxEntriesPerFile).
+	MaxEntries int
+	// MaxSize limits the size of a single (uncompressed) file (default: MaxFileSize).
+	MaxSize int
+	// Compression of the files, compressed files have the additional extension (e.g. 'sitemap.xml.gz').
+	Compression Compression
+}
+
+func (o FilesOptions) withDefaults() FilesOptions {
+	if o.Name == "" {
+		o.Name = "sitemap"
+	}
+	if o.MaxEntries <= 0 || o.MaxEntries > MaxEntriesPerFile {
+		o.MaxEntries = MaxEntriesPerFile
+	}
+	if o.MaxSize <= 0 || o.MaxSize > MaxFileSize {
+		o.MaxSize = MaxFileSize
+	}
+	return o
+}
+
+type xmlSitemapIndex struct {
+	XMLName xml.Name `xml:"sitemapindex"`
+	XMLNS   string   `xml:"xmlns,attr"`
+
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Location     string `xml:"loc"`
+	LastModified string `xml:"lastmod,omitempty"`
+}
+
+// GenerateFiles generates the sitemap as a set of named files. If all entries fit into a single file, then it's
+// the only one returned. Otherwise, entries are split into numbered child sitemaps and the main file contains
+// the sitemap index.
+func (g *Generator) GenerateFiles(t Type, options FilesOptions) ([]File, error) {
+	options = options.withDefaults()
+	ext, err := extension(t)
+	if err != nil {
+		return nil, err
+	}
+	ext += options.Compression.Extension()
+
+	chunks, err := g.split(t, g.Entries, hreflangClusters(g.Entries), options)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 1 {
+		data, err := Compress(chunks[0].data, options.Compression)
+		if err != nil {
+			return nil, err
+		}
+		return []File{{Name: options.Name + ext, Data: data}}, nil
+	}
+
+	files := make([]File, 0, len(chunks)+1)
+	index := xmlSitemapIndex{XMLNS: xmlns}
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("%s-%d%s", options.Name, i+1, ext)
+		data, err := Compress(chunk.data, options.Compression)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: name, Data: data})
+
+		location := options.BaseURL
+		location.Path = path.Join("/", location.Path, name)
+		sitemap := xmlSitemap{Location: location.String()}
+		if lastModified := latestModification(chunk.entries); !lastModified.IsZero() {
+			sitemap.LastModified = lastModified.Format(xmlLastModifiedFormat)
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemap)
+	}
+	data, err := xml.Marshal(index)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling sitemap index")
+	}
+	data, err = Compress(data, options.Compression)
+	if err != nil {
+		return nil, err
+	}
+	indexName := options.Name + ".xml" + options.Compression.Extension()
+	return append([]File{{Name: indexName, Data: data}}, files...), nil
+}
+
+// GenerateFile generates the sitemap as a single document within the limits of a single file. It returns
+// ErrTooLarge if they are exceeded.
+func (g *Generator) GenerateFile(t Type) ([]byte, error) {
+	if len(g.Entries) > MaxEntriesPerFile {
+		return nil, ErrTooLarge
+	}
+	data, err := generate(t, g.Entries, hreflangClusters(g.Entries))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+type chunk struct {
+	entries []Entry
+	data    []byte
+}
+
+// split divides entries into chunks which satisfy the limits. Chunks exceeding the size limit are split in half.
+func (g *Generator) split(
+	t Type,
+	entries []Entry,
+	clusters map[string][]Alternate,
+	options FilesOptions,
+) ([]chunk, error) {
+	if len(entries) > options.MaxEntries {
+		chunks := make([]chunk, 0)
+		for start := 0; start < len(entries); start += options.MaxEntries {
+			end := start + options.MaxEntries
+			if end > len(entries) {
+				end = len(entries)
+			}
+			c, err := g.split(t, entries[start:end], clusters, options)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, c...)
+		}
+		return chunks, nil
+	}
+
+	data, err := generate(t, entries, clusters)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= options.MaxSize || len(entries) <= 1 {
+		return []chunk{{entries: entries, data: data}}, nil
+	}
+	half := len(entries) / 2
+	left, err := g.split(t, entries[:half], clusters, options)
+	if err != nil {
+		return nil, err
+	}
+	right, err := g.split(t, entries[half:], clusters, options)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+func latestModification(entries []Entry) time.Time {
+	var latest time.Time
+	for _, entry := range entries {
+		if entry.LastModified.After(latest) {
+			latest = entry.LastModified
+		}
+	}
+	return latest
+}
+
+// FileType returns the type of the sitemap file generated by GenerateFiles (sitemap index is the XML file).
+func FileType(name string) (Type, error) {
+	name = strings.TrimSuffix(name, CompressionGzip.Extension())
+	for _, t := range []Type{TypeXML, TypePlaintext, TypeRSS, TypeAtom} {
+		if ext, _ := extension(t); strings.HasSuffix(name, ext) {
+			return t, nil
+		}
+	}
+	return "", errors.Errorf("unknown type of the sitemap file '%s'", name)
+}
+
+func extension(t Type) (string, error) {
+	switch t {
+	case TypeXML:
+		return ".xml", nil
+	case TypePlaintext:
+		return ".txt", nil
+	case TypeRSS:
+		return ".rss", nil
+	case TypeAtom:
+		return ".atom", nil
+	default:
+		return "", errors.Errorf("unsupported generator type '%s'", t)
+	}
+}
@@ -0,0 +1,145 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+var sitemapIndexXML = `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>https://google.com/sitemaps/sitemap-1.xml</loc></sitemap><sitemap><loc>https://google.com/sitemaps/sitemap-2.xml</loc><lastmod>2019-07-01T10:00:00Z</lastmod></sitemap></sitemapindex>`
+
+func TestGeneratorFilesSingleFile(t *testing.T) {
+	generator := NewGenerator()
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+
+	files, err := generator.GenerateFiles(TypePlaintext, FilesOptions{})
+	if err != nil {
+		t.Fatalf("generating sitemap files err: %s", err)
+	}
+	if len(files) != 1 || files[0].Name != "sitemap.txt" || string(files[0].Data) != "https://google.com/test1\n" {
+		t.Errorf("invalid sitemap files: %v", files)
+	}
+}
+
+func TestGeneratorFilesIndex(t *testing.T) {
+	generator := NewGenerator()
+	lastModified, _ := time.Parse(time.RFC3339, "2019-07-01T10:00:00Z")
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test2")})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test3"), LastModified: lastModified})
+
+	files, err := generator.GenerateFiles(TypeXML, FilesOptions{
+		BaseURL:    urlFromString("https://google.com/sitemaps"),
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatalf("generating sitemap files err: %s", err)
+	}
+	expectedNames := []string{"sitemap.xml", "sitemap-1.xml", "sitemap-2.xml"}
+	if len(files) != len(expectedNames) {
+		t.Fatalf("invalid number of files, got: %d, want: %d", len(files), len(expectedNames))
+	}
+	for i := range files {
+		if files[i].Name != expectedNames[i] {
+			t.Errorf("invalid file name(i=%d), got: %s, want: %s", i, files[i].Name, expectedNames[i])
+		}
+	}
+	if string(files[0].Data) != sitemapIndexXML {
+		t.Errorf("invalid sitemap index:\n%s", string(files[0].Data))
+	}
+}
+
+func TestGeneratorFilesSizeLimit(t *testing.T) {
+	generator := NewGenerator()
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test2")})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test3")})
+
+	files, err := generator.GenerateFiles(TypePlaintext, FilesOptions{
+		BaseURL: urlFromString("https://google.com"),
+		MaxSize: 40,
+	})
+	if err != nil {
+		t.Fatalf("generating sitemap files err: %s", err)
+	}
+	// Index + 3 files, as two entries exceed the size limit.
+	if len(files) != 4 {
+		t.Fatalf("invalid number of files, got: %d, want: 4", len(files))
+	}
+	for _, file := range files[1:] {
+		if len(file.Data) > 40 {
+			t.Errorf("file %s exceeds the size limit: %d", file.Name, len(file.Data))
+		}
+	}
+}
+
+func TestGeneratorFilesGzip(t *testing.T) {
+	generator := NewGenerator()
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test2")})
+
+	files, err := generator.GenerateFiles(TypePlaintext, FilesOptions{
+		BaseURL:     urlFromString("https://google.com"),
+		MaxEntries:  1,
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("generating sitemap files err: %s", err)
+	}
+	expectedNames := []string{"sitemap.xml.gz", "sitemap-1.txt.gz", "sitemap-2.txt.gz"}
+	if len(files) != len(expectedNames) {
+		t.Fatalf("invalid number of files, got: %d, want: %d", len(files), len(expectedNames))
+	}
+	for i := range files {
+		if files[i].Name != expectedNames[i] {
+			t.Errorf("invalid file name(i=%d), got: %s, want: %s", i, files[i].Name, expectedNames[i])
+		}
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(files[1].Data))
+	if err != nil {
+		t.Fatalf("reading gzip err: %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading gzip err: %s", err)
+	}
+	if string(data) != "https://google.com/test1\n" {
+		t.Errorf("invalid decompressed sitemap: %s", string(data))
+	}
+}
+
+func TestGeneratorFileLimits(t *testing.T) {
+	generator := NewGenerator()
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+	if _, err := generator.GenerateFile(TypePlaintext); err != nil {
+		t.Fatalf("generating sitemap file err: %s", err)
+	}
+
+	for i := 0; i < MaxEntriesPerFile; i++ {
+		generator.AddEntry(Entry{Location: urlFromString(fmt.Sprintf("https://google.com/%d", i))})
+	}
+	if _, err := generator.GenerateFile(TypePlaintext); err != ErrTooLarge {
+		t.Errorf("invalid error for too many entries: got: %v, want: %s", err, ErrTooLarge)
+	}
+}
+
+func TestFileType(t *testing.T) {
+	tests := map[string]Type{
+		"sitemap.xml":        TypeXML,
+		"sitemap-1.txt":      TypePlaintext,
+		"sitemap-2.rss.gz":   TypeRSS,
+		"sitemap-3.atom":     TypeAtom,
+		"sitemap-4.html":     "",
+		"sitemap-5.xml.tar":  "",
+		"sitemap-6.txt.gz.x": "",
+	}
+	for name, expected := range tests {
+		if got, _ := FileType(name); got != expected {
+			t.Errorf("FileType(%s): got: %q, want: %q", name, got, expected)
+		}
+	}
+}
@@ -6,34 +6,69 @@ import (
 	"github.com/pkg/errors"
 )
 
-const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+const (
+	xmlns      = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xmlnsXHTML = "http://www.w3.org/1999/xhtml"
+)
+
+// W3C Datetime format: https://www.w3.org/TR/NOTE-datetime
+const xmlLastModifiedFormat = "2006-01-02T15:04:05Z07:00"
 
 type xmlURLSet struct {
-	XMLName xml.Name `xml:"urlset"`
-	XMLNS   string   `xml:"xmlns,attr"`
+	XMLName    xml.Name `xml:"urlset"`
+	XMLNS      string   `xml:"xmlns,attr"`
+	XMLNSXHTML string   `xml:"xmlns:xhtml,attr,omitempty"`
 
 	URLs []xmlURL `xml:"url"`
 }
 
 type xmlURL struct {
 	Location        string    `xml:"loc"`
+	LastModified    string    `xml:"lastmod,omitempty"`
 	ChangeFrequency Frequency `xml:"changefreq,omitempty"`
 	Priority        float64   `xml:"priority,omitempty"`
+	Alternates      []xmlLink `xml:"xhtml:link"`
 }
 
-func generateXML(entries []Entry) ([]byte, error) {
+type xmlLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+func generateXML(entries []Entry, clusters map[string][]Alternate) ([]byte, error) {
 	urls := make([]xmlURL, 0, len(entries))
 	for _, entry := range entries {
+		lastModified := ""
+		if !entry.LastModified.IsZero() {
+			lastModified = entry.LastModified.Format(xmlLastModifiedFormat)
+		}
+		var links []xmlLink
+		for _, alternate := range clusters[entry.Location.String()] {
+			links = append(links, xmlLink{
+				Rel:      "alternate",
+				Hreflang: alternate.Language,
+				Href:     alternate.Location.String(),
+			})
+		}
 		urls = append(urls, xmlURL{
 			Location:        entry.Location.String(),
+			LastModified:    lastModified,
 			ChangeFrequency: entry.ChangeFrequency,
 			Priority:        entry.Priority,
+			Alternates:      links,
 		})
 	}
 	root := xmlURLSet{
 		XMLNS: xmlns,
 		URLs:  urls,
 	}
+	for _, u := range urls {
+		if len(u.Alternates) > 0 {
+			root.XMLNSXHTML = xmlnsXHTML
+			break
+		}
+	}
 	data, err := xml.Marshal(root)
 	if err != nil {
 		return nil, errors.Wrapf(err, "marshaling")
@@ -3,10 +3,13 @@ package sitemap
 import (
 	"net/url"
 	"testing"
+	"time"
 )
 
 var sitemapXML = `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>https://google.com/test1</loc></url><url><loc>https://google.com/test2</loc></url><url><loc>https://google.com/test3</loc></url></urlset>`
 
+var sitemapXMLLastModified = `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>https://google.com/test1</loc></url><url><loc>https://google.com/test2</loc><lastmod>2019-07-01T10:00:00+02:00</lastmod></url></urlset>`
+
 func urlFromString(v string) url.URL {
 	u, _ := url.Parse(v)
 	return *u
@@ -27,3 +30,19 @@ func TestGeneratorXML(t *testing.T) {
 		t.Errorf("invalid sitemap:\n%s", string(sitemap))
 	}
 }
+
+func TestGeneratorXMLLastModified(t *testing.T) {
+	generator := NewGenerator()
+
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test1")})
+	lastModified, _ := time.Parse(time.RFC3339, "2019-07-01T10:00:00+02:00")
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/test2"), LastModified: lastModified})
+
+	sitemap, err := generator.Generate(TypeXML)
+	if err != nil {
+		t.Fatalf("generating XML sitemap err: %s", err)
+	}
+	if string(sitemap) != sitemapXMLLastModified {
+		t.Errorf("invalid sitemap:\n%s", string(sitemap))
+	}
+}
@@ -0,0 +1,106 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Alternate is the language version of the page (hreflang annotation).
+// Language is the language code (e.g. 'en', 'de-CH') or 'x-default'.
+type Alternate struct {
+	Language string
+	Location url.URL
+}
+
+// hreflangClusters groups the entries which are language versions of each other. Each entry of the cluster
+// gets the same (reciprocal) list of alternates, including itself -- as Google requires.
+func hreflangClusters(entries []Entry) map[string][]Alternate {
+	// Union-find over locations (both entries and their alternates).
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(v string) string {
+		if _, ok := parent[v]; !ok {
+			parent[v] = v
+		}
+		if parent[v] != v {
+			parent[v] = find(parent[v])
+		}
+		return parent[v]
+	}
+	union := func(a, b string) {
+		parent[find(a)] = find(b)
+	}
+
+	for _, entry := range entries {
+		for _, alternate := range entry.Alternates {
+			union(entry.Location.String(), alternate.Location.String())
+		}
+	}
+
+	type key struct{ language, location string }
+	clusterAlternates := make(map[string][]Alternate)
+	seen := make(map[string]map[key]bool)
+	for _, entry := range entries {
+		for _, alternate := range entry.Alternates {
+			root := find(entry.Location.String())
+			if seen[root] == nil {
+				seen[root] = make(map[key]bool)
+			}
+			k := key{alternate.Language, alternate.Location.String()}
+			if seen[root][k] {
+				continue
+			}
+			seen[root][k] = true
+			clusterAlternates[root] = append(clusterAlternates[root], alternate)
+		}
+	}
+
+	clusters := make(map[string][]Alternate)
+	for _, entry := range entries {
+		location := entry.Location.String()
+		if _, ok := parent[location]; !ok {
+			continue
+		}
+		alternates := clusterAlternates[find(location)]
+		sort.Slice(alternates, func(i, j int) bool {
+			if alternates[i].Language != alternates[j].Language {
+				return alternates[i].Language < alternates[j].Language
+			}
+			return alternates[i].Location.String() < alternates[j].Location.String()
+		})
+		clusters[location] = alternates
+	}
+	return clusters
+}
+
+// HreflangWarnings returns the list of non-reciprocal alternates: page A declares B as its language version,
+// but B (which is in the sitemap) doesn't declare A. Search engines might ignore such annotations.
+func (g *Generator) HreflangWarnings() []string {
+	declared := make(map[string]map[string]bool)
+	for _, entry := range g.Entries {
+		location := entry.Location.String()
+		declared[location] = make(map[string]bool)
+		for _, alternate := range entry.Alternates {
+			declared[location][alternate.Location.String()] = true
+		}
+	}
+
+	warnings := make([]string, 0)
+	for _, entry := range g.Entries {
+		location := entry.Location.String()
+		for _, alternate := range entry.Alternates {
+			target := alternate.Location.String()
+			if target == location {
+				continue
+			}
+			targetDeclared, ok := declared[target]
+			if !ok || targetDeclared[location] {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("'%s' (hreflang=%s) doesn't link back to '%s'",
+				target, alternate.Language, location))
+		}
+	}
+	return warnings
+}
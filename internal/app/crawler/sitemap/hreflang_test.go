@@ -0,0 +1,69 @@
+package sitemap
+
+import (
+	"testing"
+)
+
+var sitemapXMLHreflang = `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">` +
+	`<url><loc>https://google.com/de</loc>` +
+	`<xhtml:link rel="alternate" hreflang="de" href="https://google.com/de"></xhtml:link>` +
+	`<xhtml:link rel="alternate" hreflang="en" href="https://google.com/en"></xhtml:link></url>` +
+	`<url><loc>https://google.com/en</loc>` +
+	`<xhtml:link rel="alternate" hreflang="de" href="https://google.com/de"></xhtml:link>` +
+	`<xhtml:link rel="alternate" hreflang="en" href="https://google.com/en"></xhtml:link></url>` +
+	`<url><loc>https://google.com/other</loc></url></urlset>`
+
+func TestGeneratorXMLHreflang(t *testing.T) {
+	generator := NewGenerator()
+	generator.AddEntry(Entry{
+		Location: urlFromString("https://google.com/de"),
+	})
+	generator.AddEntry(Entry{
+		Location: urlFromString("https://google.com/en"),
+		Alternates: []Alternate{
+			{Language: "en", Location: urlFromString("https://google.com/en")},
+			{Language: "de", Location: urlFromString("https://google.com/de")},
+		},
+	})
+	generator.AddEntry(Entry{Location: urlFromString("https://google.com/other")})
+
+	sitemap, err := generator.Generate(TypeXML)
+	if err != nil {
+		t.Fatalf("generating XML sitemap err: %s", err)
+	}
+	if string(sitemap) != sitemapXMLHreflang {
+		t.Errorf("invalid sitemap:\n%s", string(sitemap))
+	}
+
+	warnings := generator.HreflangWarnings()
+	expectedWarning := "'https://google.com/de' (hreflang=de) doesn't link back to 'https://google.com/en'"
+	if len(warnings) != 1 || warnings[0] != expectedWarning {
+		t.Errorf("invalid hreflang warnings: %v", warnings)
+	}
+}
+
+func TestGeneratorFilesHreflang(t *testing.T) {
+	// Language versions end up in different files, but their alternates are still reciprocal.
+	generator := NewGenerator()
+	generator.AddEntry(Entry{
+		Location: urlFromString("https://google.com/de"),
+	})
+	generator.AddEntry(Entry{
+		Location: urlFromString("https://google.com/en"),
+		Alternates: []Alternate{
+			{Language: "en", Location: urlFromString("https://google.com/en")},
+			{Language: "de", Location: urlFromString("https://google.com/de")},
+		},
+	})
+	files, err := generator.GenerateFiles(TypeXML, FilesOptions{MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("generating sitemap files err: %s", err)
+	}
+	expected := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">` +
+		`<url><loc>https://google.com/de</loc>` +
+		`<xhtml:link rel="alternate" hreflang="de" href="https://google.com/de"></xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="en" href="https://google.com/en"></xhtml:link></url></urlset>`
+	if len(files) != 3 || string(files[1].Data) != expected {
+		t.Errorf("invalid sitemap files: %v", files)
+	}
+}
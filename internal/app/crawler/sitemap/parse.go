@@ -0,0 +1,81 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Document is the parsed sitemap: list of pages (urlset, plaintext) or list of child sitemaps (sitemapindex).
+type Document struct {
+	URLs     []url.URL
+	Sitemaps []url.URL
+}
+
+type xmlDocument struct {
+	XMLName  xml.Name
+	URLs     []xmlLocation `xml:"url"`
+	Sitemaps []xmlLocation `xml:"sitemap"`
+}
+
+type xmlLocation struct {
+	Location string `xml:"loc"`
+}
+
+// Parse parses the sitemap in XML (urlset or sitemapindex) or plaintext format. Gzip-compressed sitemaps are
+// decompressed. Invalid and relative URLs are skipped.
+func Parse(data []byte) (*Document, error) {
+	data, err := Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return parsePlaintext(data), nil
+	}
+
+	var doc xmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing xml")
+	}
+	switch doc.XMLName.Local {
+	case "urlset":
+		return &Document{URLs: parseLocations(doc.URLs)}, nil
+	case "sitemapindex":
+		return &Document{Sitemaps: parseLocations(doc.Sitemaps)}, nil
+	default:
+		return nil, errors.Errorf("unsupported sitemap root element '%s'", doc.XMLName.Local)
+	}
+}
+
+func parsePlaintext(data []byte) *Document {
+	doc := &Document{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if u, ok := parseLocation(scanner.Text()); ok {
+			doc.URLs = append(doc.URLs, u)
+		}
+	}
+	return doc
+}
+
+func parseLocations(locations []xmlLocation) []url.URL {
+	urls := make([]url.URL, 0, len(locations))
+	for _, location := range locations {
+		if u, ok := parseLocation(location.Location); ok {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func parseLocation(v string) (url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return url.URL{}, false
+	}
+	return *u, true
+}
@@ -0,0 +1,66 @@
+package sitemap
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://google.com/</loc><lastmod>2019-06-28</lastmod></url>
+  <url><loc> https://google.com/a </loc></url>
+  <url><loc>/relative</loc></url>
+</urlset>`
+	index := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://google.com/sitemap-1.xml.gz</loc></sitemap>
+</sitemapindex>`
+	compressed, err := Compress([]byte(urlset), CompressionGzip)
+	if err != nil {
+		t.Fatalf("couldn't compress: %s", err)
+	}
+
+	tests := []struct {
+		name             string
+		data             []byte
+		expectedURLs     []string
+		expectedSitemaps []string
+	}{
+		{"urlset", []byte(urlset), []string{"https://google.com/", "https://google.com/a"}, nil},
+		{"gzip", compressed, []string{"https://google.com/", "https://google.com/a"}, nil},
+		{"sitemap index", []byte(index), nil, []string{"https://google.com/sitemap-1.xml.gz"}},
+		{
+			name:         "plaintext",
+			data:         []byte("https://google.com/\n\nhttps://google.com/b\n"),
+			expectedURLs: []string{"https://google.com/", "https://google.com/b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := Parse(test.data)
+			if err != nil {
+				t.Fatalf("couldn't parse: %s", err)
+			}
+			if len(doc.URLs) != len(test.expectedURLs) || len(doc.Sitemaps) != len(test.expectedSitemaps) {
+				t.Fatalf("invalid document: %v", doc)
+			}
+			for i, u := range doc.URLs {
+				if u.String() != test.expectedURLs[i] {
+					t.Errorf("invalid url(i=%d): got: %s, want: %s", i, u.String(), test.expectedURLs[i])
+				}
+			}
+			for i, u := range doc.Sitemaps {
+				if u.String() != test.expectedSitemaps[i] {
+					t.Errorf("invalid sitemap(i=%d): got: %s, want: %s", i, u.String(), test.expectedSitemaps[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseUnsupportedDocument(t *testing.T) {
+	if _, err := Parse([]byte(`<rss version="2.0"></rss>`)); err == nil {
+		t.Errorf("unsupported document should be rejected")
+	}
+}
@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+)
+
+// Stats describes the state of the crawl.
+type Stats struct {
+	// Fetched is the number of processed URLs (including the failed ones).
+	Fetched int
+	// Retried is the number of failed requests which were scheduled to be repeated.
+	Retried int
+	// Failed is the number of URLs which couldn't be processed (after all retries).
+	Failed int
+	// NotModified is the number of pages which didn't change since the previous crawl (304 response).
+	NotModified int
+	// Unchanged is the number of pages fetched again, but with the same content as in the previous crawl.
+	Unchanged int
+	// Truncated is the number of URLs which weren't crawled, because they look like a crawl trap.
+	Truncated int
+	// Processed is the number of URLs in the history (discovered URLs which passed the scope and robots checks).
+	Processed int
+	// HistoryMemory is the estimated number of bytes used by the history of processed URLs.
+	HistoryMemory int
+	// HeapInUse is the number of bytes of the heap memory used by the process (shared by all running crawls).
+	HeapInUse uint64
+	// RequestDelay is the effective delay between requests to the crawled host.
+	RequestDelay time.Duration
+	// RequestsPerSecond is the effective rate limit of requests to the crawled host (0 means unlimited).
+	RequestsPerSecond float64
+}
+
+// Failure describes why the URL couldn't be processed.
+type Failure struct {
+	URL        url.URL
+	StatusCode int
+	Attempts   int
+	Reason     string
+}
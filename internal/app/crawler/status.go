@@ -0,0 +1,24 @@
+package crawler
+
+// Status describes how the crawl ended.
+type Status string
+
+const (
+	// StatusRunning is the status of the crawl which hasn't ended yet.
+	StatusRunning Status = "running"
+	// StatusComplete means that all URLs in scope were processed.
+	StatusComplete Status = "complete"
+	// StatusTimedOut means that the crawl exceeded its timeout.
+	StatusTimedOut Status = "timeout"
+	// StatusCancelled means that the crawl was cancelled (e.g. client disconnected).
+	StatusCancelled Status = "cancelled"
+	// StatusPageLimit means that the crawl stopped after fetching the maximum number of pages.
+	StatusPageLimit Status = "page_limit"
+	// StatusFailed means that the crawl couldn't be started or resumed (e.g. the checkpoint is missing).
+	StatusFailed Status = "failed"
+)
+
+// Partial checks if the sitemap generated by the crawl might be missing some URLs.
+func (s Status) Partial() bool {
+	return s != StatusComplete
+}
@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons why the URLs were recognized as a crawl trap.
+const (
+	TrapPathDepth        = "path depth"
+	TrapRepeatedSegments = "repeated path segments"
+	TrapPatternBudget    = "pattern budget"
+	TrapCalendar         = "calendar"
+)
+
+const (
+	numberPlaceholder = "{n}"
+	datePlaceholder   = "{date}"
+)
+
+var (
+	numberRegexp = regexp.MustCompile(`^-?\d+$`)
+	// dateRegexp matches the months and days with separators (e.g. 2019-06, 2019/06/28). Numbers without them
+	// (e.g. 2012, 19990101) are more often the IDs than the dates.
+	dateRegexp = regexp.MustCompile(`^(19|20)\d{2}[-/.](0?[1-9]|1[0-2])([-/.](0?[1-9]|[12]\d|3[01]))?$`)
+	// yearRegexp and monthRegexp match the date split into path segments (e.g. '/2019/06/28').
+	yearRegexp  = regexp.MustCompile(`^(19|20)\d{2}$`)
+	monthRegexp = regexp.MustCompile(`^(0?[1-9]|1[0-2])$`)
+	// dateParams are the GET params which usually hold a part of the date in calendars.
+	dateParams = map[string]bool{"year": true, "month": true, "day": true, "week": true, "date": true}
+)
+
+// TrapLimits configure the heuristics which detect crawl traps (sites generating infinite number of pages,
+// e.g. '?p=n' linking to '?p=n+1'). Zero value disables the heuristic.
+type TrapLimits struct {
+	// MaxPathDepth is the maximum number of path segments.
+	MaxPathDepth int
+	// MaxRepeatedSegments is the maximum number of occurrences of the same segment in the path
+	// (e.g. '/a/b/a/b/a/b' produced by relative links).
+	MaxRepeatedSegments int
+	// MaxURLsPerPattern is the maximum number of URLs with the same path which differ only by numeric GET params.
+	// The default limit stops the pagination traps (e.g. '?p=n') early, large catalogs (e.g. '?id=n') might need
+	// a higher one.
+	MaxURLsPerPattern int
+	// MaxCalendarURLs is the maximum number of URLs with the same path which differ only by dates
+	// (in path segments or GET params).
+	MaxCalendarURLs int
+}
+
+func DefaultTrapLimits() TrapLimits {
+	return TrapLimits{
+		MaxPathDepth:        16,
+		MaxRepeatedSegments: 3,
+		MaxURLsPerPattern:   1000,
+		MaxCalendarURLs:     500,
+	}
+}
+
+// Truncation describes the URL pattern which wasn't crawled completely, because it looks like a crawl trap.
+type Truncation struct {
+	Pattern string
+	Reason  string
+	// Skipped is the number of URLs which weren't crawled.
+	Skipped int
+	// Example is the first skipped URL.
+	Example url.URL
+}
+
+// traps decides which URLs are crawl traps and keeps the report of truncated patterns.
+type traps struct {
+	limits TrapLimits
+
+	patterns    map[string]int
+	truncations map[string]*Truncation
+	order       []string
+}
+
+func newTraps(limits TrapLimits) *traps {
+	return &traps{
+		limits:      limits,
+		patterns:    make(map[string]int),
+		truncations: make(map[string]*Truncation),
+	}
+}
+
+// Allow checks if the URL should be crawled. It should be called once per URL, because each call
+// uses the budget of the URL pattern.
+func (t *traps) Allow(u url.URL) bool {
+	segments := pathSegments(u.Path)
+
+	if t.limits.MaxPathDepth > 0 && len(segments) > t.limits.MaxPathDepth {
+		pattern := u.Host + "/" + strings.Join(segments[:t.limits.MaxPathDepth], "/") + "/*"
+		t.truncate(pattern, TrapPathDepth, u)
+		return false
+	}
+	if t.limits.MaxRepeatedSegments > 0 {
+		occurrences := make(map[string]int, len(segments))
+		for i, segment := range segments {
+			occurrences[segment]++
+			if occurrences[segment] > t.limits.MaxRepeatedSegments {
+				pattern := u.Host + "/" + strings.Join(segments[:i+1], "/") + "*"
+				t.truncate(pattern, TrapRepeatedSegments, u)
+				return false
+			}
+		}
+	}
+
+	pattern, numbers, calendar := urlPattern(u, segments)
+	reason, budget := TrapPatternBudget, t.limits.MaxURLsPerPattern
+	if calendar {
+		reason, budget = TrapCalendar, t.limits.MaxCalendarURLs
+	}
+	if budget <= 0 || !(numbers || calendar) {
+		// URL doesn't have any variable parts, so it's the only URL with its pattern.
+		return true
+	}
+	if t.patterns[pattern] >= budget {
+		t.truncate(pattern, reason, u)
+		return false
+	}
+	t.patterns[pattern]++
+	return true
+}
+
+func (t *traps) truncate(pattern string, reason string, u url.URL) {
+	key := truncationKey(reason, pattern)
+	truncation, ok := t.truncations[key]
+	if !ok {
+		truncation = &Truncation{Pattern: pattern, Reason: reason, Example: u}
+		t.truncations[key] = truncation
+		t.order = append(t.order, key)
+	}
+	truncation.Skipped++
+}
+
+func truncationKey(reason string, pattern string) string {
+	return reason + " " + pattern
+}
+
+// Truncations returns the truncated patterns in order of detection.
+func (t *traps) Truncations() []Truncation {
+	truncations := make([]Truncation, 0, len(t.order))
+	for _, key := range t.order {
+		truncations = append(truncations, *t.truncations[key])
+	}
+	return truncations
+}
+
+// urlPattern replaces the dates (in path and GET params) and numeric GET params with placeholders.
+// It reports if any numeric param or date (so the URL is a part of the calendar) was found.
+func urlPattern(u url.URL, segments []string) (pattern string, numbers, calendar bool) {
+	patternSegments := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		// Month and day might be separate segments following the year (e.g. '/2019/06/28'), the year alone
+		// isn't a date.
+		dateStarted := yearRegexp.MatchString(segment) && i+1 < len(segments) && monthRegexp.MatchString(segments[i+1])
+		dateContinued := i > 0 && patternSegments[i-1] == datePlaceholder && len(segment) <= 2 &&
+			numberRegexp.MatchString(segment)
+		if dateStarted || dateContinued || dateRegexp.MatchString(segment) {
+			segment = datePlaceholder
+			calendar = true
+		}
+		patternSegments = append(patternSegments, segment)
+	}
+	pattern = u.Host + "/" + strings.Join(patternSegments, "/")
+
+	query := u.Query()
+	if len(query) == 0 {
+		return pattern, false, calendar
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(query[key], ",")
+		switch {
+		case dateRegexp.MatchString(value) || (dateParams[strings.ToLower(key)] && numberRegexp.MatchString(value)):
+			value = datePlaceholder
+			calendar = true
+		case numberRegexp.MatchString(value):
+			value = numberPlaceholder
+			numbers = true
+		}
+		params = append(params, key+"="+value)
+	}
+	return pattern + "?" + strings.Join(params, "&"), numbers, calendar
+}
+
+func pathSegments(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
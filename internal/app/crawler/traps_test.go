@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestTrapsAllow(t *testing.T) {
+	limits := TrapLimits{
+		MaxPathDepth:        4,
+		MaxRepeatedSegments: 2,
+		MaxURLsPerPattern:   3,
+		MaxCalendarURLs:     2,
+	}
+	tests := []struct {
+		name     string
+		urls     []string
+		expected []bool
+	}{
+		{
+			name:     "path depth",
+			urls:     []string{"https://google.com/a/b/c/d", "https://google.com/a/b/c/d/e"},
+			expected: []bool{true, false},
+		},
+		{
+			name:     "repeated segments",
+			urls:     []string{"https://google.com/a/b/a/b", "https://google.com/a/a/a"},
+			expected: []bool{true, false},
+		},
+		{
+			name: "numeric params",
+			urls: []string{
+				"https://google.com/list?p=1",
+				"https://google.com/list?p=2",
+				"https://google.com/list?p=3",
+				"https://google.com/list?p=4",
+				"https://google.com/list?p=5&sort=asc",
+				"https://google.com/other?p=5",
+			},
+			expected: []bool{true, true, true, false, true, true},
+		},
+		{
+			name: "params which are not numeric are not limited",
+			urls: []string{
+				"https://google.com/search?q=a",
+				"https://google.com/search?q=b",
+				"https://google.com/search?q=c",
+				"https://google.com/search?q=d",
+			},
+			expected: []bool{true, true, true, true},
+		},
+		{
+			name: "calendar",
+			urls: []string{
+				"https://google.com/calendar/2019/06",
+				"https://google.com/calendar/2019/07",
+				"https://google.com/calendar/2019/08",
+				"https://google.com/calendar/2019/08/01",
+				"https://google.com/events?date=2019-06-28",
+				"https://google.com/events?date=2019-06-29",
+				"https://google.com/events?date=2019-06-30",
+				"https://google.com/events?year=2019&month=7",
+				"https://google.com/events?year=2019&month=8",
+				"https://google.com/events?year=2019&month=9",
+			},
+			expected: []bool{true, true, false, true, true, true, false, true, true, false},
+		},
+		{
+			name: "numeric IDs are not dates",
+			urls: []string{
+				"https://google.com/item/2012",
+				"https://google.com/item/2013",
+				"https://google.com/item/2014",
+				"https://google.com/p/200512",
+				"https://google.com/p/200601",
+				"https://google.com/p/200602",
+				"https://google.com/product/19990101",
+				"https://google.com/product/19990102",
+				"https://google.com/product/19990103",
+				"https://google.com/list?id=20190628",
+				"https://google.com/list?id=20190629",
+				"https://google.com/list?id=20190630",
+			},
+			expected: []bool{true, true, true, true, true, true, true, true, true, true, true, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			traps := newTraps(limits)
+			for i, rawURL := range test.urls {
+				u, err := url.Parse(rawURL)
+				if err != nil {
+					t.Fatalf("invalid url '%s': %s", rawURL, err)
+				}
+				if allowed := traps.Allow(*u); allowed != test.expected[i] {
+					t.Errorf("Allow(%s): got: %t, want: %t", rawURL, allowed, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrapsTruncations(t *testing.T) {
+	traps := newTraps(TrapLimits{MaxURLsPerPattern: 2})
+	for i := 0; i < 5; i++ {
+		u, _ := url.Parse(fmt.Sprintf("https://google.com/list?p=%d", i))
+		traps.Allow(*u)
+	}
+
+	truncations := traps.Truncations()
+	if len(truncations) != 1 {
+		t.Fatalf("invalid number of truncations: got: %d, want: 1", len(truncations))
+	}
+	truncation := truncations[0]
+	if truncation.Pattern != "google.com/list?p={n}" || truncation.Reason != TrapPatternBudget {
+		t.Errorf("invalid truncation: %+v", truncation)
+	}
+	if truncation.Skipped != 3 || truncation.Example.String() != "https://google.com/list?p=2" {
+		t.Errorf("invalid skipped URLs: got: %d (example %s), want: 3", truncation.Skipped, truncation.Example.String())
+	}
+}
@@ -2,42 +2,278 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/mwarzynski/crawler/pkg/logging"
 
 	"github.com/mwarzynski/crawler/internal/app/crawler"
 	"github.com/mwarzynski/crawler/internal/app/crawler/http"
+	"github.com/mwarzynski/crawler/internal/app/crawler/retry"
 	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
 )
 
-// processorsCount should be configurable. Maybe some sites need more workers than others.
-// For now, let's leave it as a const.
-const processorsCount = 10
+// DefaultRequestDelay is the minimum delay between requests to the same host.
+// Crawler shouldn't look like a DoS attack, so we limit it even if robots.txt doesn't specify the Crawl-delay.
+const DefaultRequestDelay = time.Millisecond * 100
+
+// ParseRequestDelay parses the minimum delay between requests (e.g. REQUEST_DELAY env), empty value means
+// the DefaultRequestDelay.
+func ParseRequestDelay(v string) (time.Duration, error) {
+	if v == "" {
+		return DefaultRequestDelay, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.Errorf("request delay can't be negative: %s", d)
+	}
+	return d, nil
+}
+
+var (
+	ErrNoSeeds    = errors.New("at least one seed URL is required")
+	ErrNoStateDir = errors.New("state directory is required to resume the crawl or to crawl incrementally")
+	// ErrCrawlIDInUse is returned when the crawl with the same ID (so the same checkpoints) is already running.
+	ErrCrawlIDInUse = errors.New("crawl with the same ID is already running")
+)
 
 type Service struct {
+	botName        string
+	requestDelay   time.Duration
 	fetcherCreator http.FetcherCreator
+	// stateDir is the directory of the crawl checkpoints (checkpoints are disabled if it's empty).
+	stateDir string
+	// running are the IDs of the running crawls, each of them owns its checkpoint directory.
+	runningMu sync.Mutex
+	running   map[string]bool
 
 	log logging.Logger
 }
 
-func NewService(fetcherCreator http.FetcherCreator, log logging.Logger) *Service {
+func NewService(
+	botName string,
+	requestDelay time.Duration,
+	fetcherCreator http.FetcherCreator,
+	stateDir string,
+	log logging.Logger,
+) *Service {
 	return &Service{
+		botName:        botName,
+		requestDelay:   requestDelay,
 		fetcherCreator: fetcherCreator,
+		stateDir:       stateDir,
+		running:        make(map[string]bool),
 		log:            logging.WithFields(log, "app", "service"),
 	}
 }
 
-func (s *Service) GenerateSitemap(ctx context.Context, baseURL url.URL, sitemapType sitemap.Type) ([]byte, error) {
-	manager := crawler.NewManager(
-		processorsCount,
-		baseURL,
+// GenerateSitemap crawls the site starting at the seeds and generates the sitemap. The first seed defines
+// the crawled site. Status tells if the sitemap is complete (partial sitemap is returned only if it's allowed
+// by the options). If the options resume the crawl, seeds might be omitted (they are read from the checkpoint).
+// Sitemap exceeding the limits of a single file isn't generated (sitemap.ErrTooLarge), see GenerateSitemapFiles.
+func (s *Service) GenerateSitemap(
+	ctx context.Context,
+	seeds []url.URL,
+	sitemapType sitemap.Type,
+	options crawler.CrawlOptions,
+) ([]byte, crawler.Status, error) {
+	sitemapGenerator, status, err := s.crawl(ctx, seeds, options)
+	if err != nil {
+		return []byte{}, status, err
+	}
+	data, err := sitemapGenerator.GenerateFile(sitemapType)
+	return data, status, err
+}
+
+// GenerateSitemapFiles generates the sitemap split into files (with the sitemap index if limits are exceeded).
+// If files base URL is not specified, we assume the files are going to be hosted at the root of the crawled site.
+func (s *Service) GenerateSitemapFiles(
+	ctx context.Context,
+	seeds []url.URL,
+	sitemapType sitemap.Type,
+	options crawler.CrawlOptions,
+	filesOptions sitemap.FilesOptions,
+) ([]sitemap.File, crawler.Status, error) {
+	options = s.checkpointOptions(options)
+	seeds, err := s.seeds(seeds, options)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(seeds) > 0 && filesOptions.BaseURL.Host == "" {
+		filesOptions.BaseURL = url.URL{Scheme: seeds[0].Scheme, Host: seeds[0].Host}
+	}
+	sitemapGenerator, status, err := s.crawl(ctx, seeds, options)
+	if err != nil {
+		return nil, status, err
+	}
+	files, err := sitemapGenerator.GenerateFiles(sitemapType, filesOptions)
+	return files, status, err
+}
+
+func (s *Service) crawl(
+	ctx context.Context,
+	seeds []url.URL,
+	options crawler.CrawlOptions,
+) (*sitemap.Generator, crawler.Status, error) {
+	manager, err := s.newManager(seeds, options)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.run(ctx, manager)
+}
+
+// newManager creates the manager of the crawl (seeds and options of the resumed crawl are read from its checkpoint).
+func (s *Service) newManager(seeds []url.URL, options crawler.CrawlOptions) (*crawler.Manager, error) {
+	options = s.checkpointOptions(options)
+	seeds, err := s.seeds(seeds, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Checkpoint.Resume {
+		if options, err = crawler.ResumeOptions(options); err != nil {
+			return nil, err
+		}
+	}
+	baseURL := seeds[0]
+	if options, err = s.incrementalOptions(options, baseURL); err != nil {
+		return nil, err
+	}
+	if options.Checkpoint.ID != "" {
+		s.log.WithField("url", baseURL.String()).Infof("crawl ID: %s", options.Checkpoint.ID)
+	}
+	return crawler.NewManager(
+		seeds,
+		s.botName,
+		s.requestDelay,
+		retry.DefaultPolicy(),
+		options,
 		s.fetcherCreator,
 		s.log.WithField("url", baseURL.String()),
-	)
+	), nil
+}
+
+// run runs the crawl and logs its report.
+func (s *Service) run(ctx context.Context, manager *crawler.Manager) (*sitemap.Generator, crawler.Status, error) {
+	baseURL := manager.BaseURL()
+	if id := manager.ID(); id != "" {
+		if !s.lockCrawlID(id) {
+			return nil, crawler.StatusFailed, ErrCrawlIDInUse
+		}
+		defer s.unlockCrawlID(id)
+	}
 	sitemapGenerator, err := manager.SitemapGenerator(ctx)
+	stats, status := manager.Stats(), manager.Status()
+	s.log.WithField("url", baseURL.String()).Infof(
+		"crawl stats: status=%s, fetched=%d, retried=%d, failed=%d, truncated=%d, request delay=%s, requests/s=%.2f, "+
+			"processed=%d, history memory=%dB, heap in use=%dB, not modified=%d, unchanged=%d",
+		status, stats.Fetched, stats.Retried, stats.Failed, stats.Truncated, stats.RequestDelay, stats.RequestsPerSecond,
+		stats.Processed, stats.HistoryMemory, stats.HeapInUse, stats.NotModified, stats.Unchanged,
+	)
 	if err != nil {
-		return []byte{}, err
+		return nil, status, err
+	}
+	for _, issue := range manager.CanonicalIssues() {
+		chain := make([]string, 0, len(issue.Chain))
+		for _, u := range issue.Chain {
+			chain = append(chain, u.String())
+		}
+		s.log.WithField("url", baseURL.String()).Infof("canonical: chain=%s, cross-host=%t",
+			strings.Join(chain, " -> "), issue.CrossHost)
+	}
+	for _, truncation := range manager.Truncations() {
+		s.log.WithField("url", baseURL.String()).Infof("crawl trap: pattern=%s, reason=%s, skipped=%d, example=%s",
+			truncation.Pattern, truncation.Reason, truncation.Skipped, truncation.Example.String())
+	}
+	for _, warning := range sitemapGenerator.HreflangWarnings() {
+		s.log.WithField("url", baseURL.String()).Infof("hreflang: %s", warning)
+	}
+	return sitemapGenerator, status, nil
+}
+
+// lockCrawlID reserves the crawl ID, so concurrent crawls with the same ID don't overwrite each other's checkpoints.
+// It returns false if the ID is already reserved.
+func (s *Service) lockCrawlID(id string) bool {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+func (s *Service) unlockCrawlID(id string) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	delete(s.running, id)
+}
+
+// checkpointOptions enables the checkpoints in the service's state directory (unless the options specify
+// the directory).
+func (s *Service) checkpointOptions(options crawler.CrawlOptions) crawler.CrawlOptions {
+	if options.Checkpoint.Dir == "" {
+		options.Checkpoint.Dir = s.stateDir
+	}
+	return options
+}
+
+// seeds returns the seeds of the crawl. Resumed crawl uses the seeds saved in its checkpoint, if they are omitted.
+func (s *Service) seeds(seeds []url.URL, options crawler.CrawlOptions) ([]url.URL, error) {
+	if options.Checkpoint.Resume {
+		if options.Checkpoint.Dir == "" {
+			return nil, ErrNoStateDir
+		}
+		if len(seeds) == 0 {
+			return crawler.CheckpointSeeds(options.Checkpoint.Dir, options.Checkpoint.ID)
+		}
+	}
+	if len(seeds) == 0 {
+		return nil, ErrNoSeeds
+	}
+	return seeds, nil
+}
+
+// incrementalOptions keeps the state of the pages of each site (seed and scope) in the service's state directory
+// (unless the options specify the path).
+func (s *Service) incrementalOptions(options crawler.CrawlOptions, baseURL url.URL) (crawler.CrawlOptions, error) {
+	if !options.Incremental.Enabled || options.Incremental.Path != "" {
+		return options, nil
+	}
+	if s.stateDir == "" {
+		return options, ErrNoStateDir
+	}
+	dir := filepath.Join(s.stateDir, "sites")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return options, errors.Wrapf(err, "creating directory '%s'", dir)
+	}
+	options.Incremental.Path = filepath.Join(dir, incrementalStateName(baseURL, options.Scope))
+	return options, nil
+}
+
+// incrementalStateName names the state of the pages after the seed and the scope, as they decide which pages
+// are crawled. Host is kept in the name, so the files are easy to find.
+func incrementalStateName(baseURL url.URL, scope crawler.Scope) string {
+	hosts := make([]string, 0, len(scope.Hosts))
+	for _, host := range scope.Hosts {
+		hosts = append(hosts, strings.ToLower(host))
 	}
-	return sitemapGenerator.Generate(sitemapType)
+	sort.Strings(hosts)
+	key := fmt.Sprintf("%s %s %s %t", baseURL.String(), scope.Mode, strings.Join(hosts, ","), scope.StrictScheme)
+	sum := sha256.Sum256([]byte(key))
+	// Host might contain the port, which isn't allowed in the file names on some systems.
+	host := strings.Replace(strings.ToLower(baseURL.Host), ":", "_", -1)
+	return host + "-" + hex.EncodeToString(sum[:8]) + ".json"
 }
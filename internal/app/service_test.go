@@ -0,0 +1,30 @@
+package app
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+)
+
+func TestIncrementalStateName(t *testing.T) {
+	seed, _ := url.Parse("https://example.com:8080/")
+	docs, _ := url.Parse("https://example.com:8080/docs/")
+	hosts := crawler.Scope{Mode: crawler.ScopeHosts, Hosts: []string{"a.example.com", "B.example.com"}}
+
+	name := incrementalStateName(*seed, hosts)
+	if !strings.HasPrefix(name, "example.com_8080-") || !strings.HasSuffix(name, ".json") {
+		t.Errorf("name should contain the host, got: %s", name)
+	}
+	reordered := crawler.Scope{Mode: crawler.ScopeHosts, Hosts: []string{"b.example.com", "a.example.com"}}
+	if incrementalStateName(*seed, reordered) != name {
+		t.Errorf("order of the hosts shouldn't change the name")
+	}
+	if incrementalStateName(*seed, crawler.Scope{Mode: crawler.ScopeHost}) == name {
+		t.Errorf("other scope should have other state")
+	}
+	if incrementalStateName(*docs, hosts) == name {
+		t.Errorf("other seed should have other state")
+	}
+}
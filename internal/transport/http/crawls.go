@@ -0,0 +1,240 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app"
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
+	"github.com/mwarzynski/crawler/pkg/logging"
+)
+
+// crawlView is the JSON representation of the crawl running in the background.
+type crawlView struct {
+	ID       string         `json:"id"`
+	Status   crawler.Status `json:"status"`
+	Seeds    []string       `json:"seeds"`
+	Created  time.Time      `json:"created"`
+	Finished *time.Time     `json:"finished,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Progress crawlProgress  `json:"progress"`
+}
+
+type crawlProgress struct {
+	Fetched     int `json:"fetched"`
+	Retried     int `json:"retried"`
+	Failed      int `json:"failed"`
+	Truncated   int `json:"truncated"`
+	Processed   int `json:"processed"`
+	NotModified int `json:"not_modified"`
+	Unchanged   int `json:"unchanged"`
+}
+
+func newCrawlView(c *app.Crawl) crawlView {
+	view := crawlView{
+		ID:       c.ID,
+		Status:   c.Status(),
+		Seeds:    make([]string, 0, len(c.Seeds)),
+		Created:  c.Created,
+		Progress: newCrawlProgress(c.Stats()),
+	}
+	for _, seed := range c.Seeds {
+		view.Seeds = append(view.Seeds, seed.String())
+	}
+	if finished, ok := c.Finished(); ok {
+		view.Finished = &finished
+	}
+	if err := c.Err(); err != nil {
+		view.Error = err.Error()
+	}
+	return view
+}
+
+func newCrawlProgress(stats crawler.Stats) crawlProgress {
+	return crawlProgress{
+		Fetched:     stats.Fetched,
+		Retried:     stats.Retried,
+		Failed:      stats.Failed,
+		Truncated:   stats.Truncated,
+		Processed:   stats.Processed,
+		NotModified: stats.NotModified,
+		Unchanged:   stats.Unchanged,
+	}
+}
+
+// HandleStartCrawl starts the crawl in the background. It accepts the same params as HandleSitemap
+// and responds with the crawl ID, which is used to poll its progress and download the sitemap.
+func HandleStartCrawl(service *app.Service, crawls *app.CrawlStore, log logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seeds, err := seedURLs(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		options, err := crawlOptions(r)
+		if err != nil {
+			http.Error(w, "provided crawl options are invalid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(seeds) == 0 && !options.Checkpoint.Resume {
+			http.Error(w, "provided url is empty", http.StatusBadRequest)
+			return
+		}
+
+		c, err := service.NewCrawl(seeds, options)
+		switch errors.Cause(err) {
+		case nil:
+		case crawler.ErrCheckpointNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case app.ErrNoStateDir, crawler.ErrInvalidCheckpointOptions, app.ErrNoSeeds:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch err := crawls.Add(c); err {
+		case nil:
+		case app.ErrTooManyCrawls:
+			c.Cancel()
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case app.ErrCrawlExists:
+			c.Cancel()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			c.Cancel()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.Start()
+
+		w.Header().Set("Location", "/crawls/"+c.ID)
+		writeJSON(w, http.StatusAccepted, newCrawlView(c), log)
+	}
+}
+
+// HandleGetCrawl responds with the status and progress of the crawl.
+func HandleGetCrawl(crawls *app.CrawlStore, log logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := crawls.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, newCrawlView(c), log)
+	}
+}
+
+// HandleCrawlSitemap responds with the sitemap of the crawl which ended (409 if it's still running). If the sitemap
+// exceeds the limits of a single file, the response is the sitemap index of the files served by
+// HandleCrawlSitemapFile.
+func HandleCrawlSitemap(crawls *app.CrawlStore, log logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := crawls.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sitemapType, compression, err := sitemapFormat(r, "format")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files, ok := crawlSitemapFiles(w, r, c, sitemapType)
+		if !ok {
+			return
+		}
+		if len(files) > 1 {
+			sitemapType = sitemap.TypeXML
+		}
+		writeSitemap(w, r, files[0].Data, c.Status(), contentType(sitemapType), compression, log)
+	}
+}
+
+// HandleCrawlSitemapFile responds with the child sitemap listed in the sitemap index of the crawl.
+func HandleCrawlSitemapFile(crawls *app.CrawlStore, log logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := crawls.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		name := chi.URLParam(r, "name")
+		sitemapType, err := sitemap.FileType(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		_, compression, err := sitemapFormat(r, "format")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files, ok := crawlSitemapFiles(w, r, c, sitemapType)
+		if !ok {
+			return
+		}
+		// The first file is the sitemap index (or the whole sitemap, if it wasn't split).
+		for _, file := range files[1:] {
+			if file.Name == name {
+				writeSitemap(w, r, file.Data, c.Status(), contentType(sitemapType), compression, log)
+				return
+			}
+		}
+		http.Error(w, "sitemap file not found", http.StatusNotFound)
+	}
+}
+
+// crawlSitemapFiles generates the sitemap files of the crawl. Child sitemaps are located under the sitemap URL
+// of the crawl. It writes the error response if the files can't be generated.
+func crawlSitemapFiles(w http.ResponseWriter, r *http.Request, c *app.Crawl, t sitemap.Type) ([]sitemap.File, bool) {
+	baseURL := url.URL{Scheme: "http", Host: r.Host, Path: "/crawls/" + c.ID + "/sitemap/"}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		baseURL.Scheme = "https"
+	}
+	files, err := c.SitemapFiles(t, sitemap.FilesOptions{BaseURL: baseURL})
+	switch err {
+	case nil:
+		return files, true
+	case app.ErrCrawlRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return nil, false
+}
+
+// HandleDeleteCrawl cancels the running crawl (its partial sitemap is kept) or removes the crawl which ended.
+func HandleDeleteCrawl(crawls *app.CrawlStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := crawls.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if _, ok := c.Finished(); !ok {
+			c.Cancel()
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		crawls.Remove(c.ID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}, log logging.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("couldn't write data: %s", err)
+	}
+}
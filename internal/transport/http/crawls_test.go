@@ -0,0 +1,262 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/mwarzynski/crawler/internal/app"
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	chttp "github.com/mwarzynski/crawler/internal/app/crawler/http"
+)
+
+// hangingPath doesn't respond until the request is cancelled, so the crawls starting at it keep running.
+const hangingPath = "/hanging"
+
+// mockFetcher serves the site with a single page (robots.txt is missing).
+type mockFetcher struct {
+	// started receives the URL of each hanging request.
+	started chan string
+}
+
+func (f *mockFetcher) Fetch(ctx context.Context, u url.URL, _ chttp.FetchOptions) (*chttp.Response, error) {
+	resp := &chttp.Response{StatusCode: http.StatusOK, Header: make(http.Header), URL: u, Protocol: "HTTP/1.1"}
+	switch u.Path {
+	case "/robots.txt":
+		resp.StatusCode = http.StatusNotFound
+		return resp, chttp.ErrInvalidStatusCode
+	case hangingPath:
+		select {
+		case f.started <- u.String():
+		default:
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	resp.Body = []byte(`<html><head><title>Example</title></head><body></body></html>`)
+	return resp, nil
+}
+
+type testServer struct {
+	handler  http.Handler
+	crawls   *app.CrawlStore
+	fetcher  *mockFetcher
+	stateDir string
+}
+
+func newTestServer(t *testing.T, maxCrawls int) *testServer {
+	stateDir, err := ioutil.TempDir("", "crawler-http-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	f := &mockFetcher{started: make(chan string, 10)}
+	service := app.NewService("crawler-bot", 0, func() chttp.Fetcher { return f }, stateDir, log)
+	crawls := app.NewCrawlStore(maxCrawls, time.Hour)
+	return &testServer{
+		handler:  newRouter(service, crawls, log),
+		crawls:   crawls,
+		fetcher:  f,
+		stateDir: stateDir,
+	}
+}
+
+// close cancels the crawls which are still running and removes the state directory.
+func (s *testServer) close(ids ...string) {
+	for _, id := range ids {
+		if c, err := s.crawls.Get(id); err == nil {
+			c.Cancel()
+			<-c.Done()
+		}
+	}
+	os.RemoveAll(s.stateDir)
+}
+
+func (s *testServer) do(method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// start starts the crawl and checks that it was accepted.
+func (s *testServer) start(t *testing.T, query string) crawlView {
+	w := s.do(http.MethodPost, "/crawls?"+query)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /crawls?%s: got: %d, want: %d, body: %s", query, w.Code, http.StatusAccepted, w.Body.String())
+	}
+	var view crawlView
+	if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+		t.Fatalf("invalid crawl: %s", err)
+	}
+	if location := w.Header().Get("Location"); location != "/crawls/"+view.ID {
+		t.Errorf("invalid location: got: %q, want: %q", location, "/crawls/"+view.ID)
+	}
+	return view
+}
+
+func (s *testServer) wait(t *testing.T, id string) {
+	c, err := s.crawls.Get(id)
+	if err != nil {
+		t.Fatalf("crawl '%s': %s", id, err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("crawl '%s' didn't end", id)
+	}
+}
+
+func (s *testServer) waitForHangingRequest(t *testing.T) {
+	select {
+	case <-s.fetcher.started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("hanging page wasn't requested")
+	}
+}
+
+func (s *testServer) get(t *testing.T, id string) crawlView {
+	w := s.do(http.MethodGet, "/crawls/"+id)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /crawls/%s: got: %d, want: %d", id, w.Code, http.StatusOK)
+	}
+	var view crawlView
+	if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+		t.Fatalf("invalid crawl: %s", err)
+	}
+	return view
+}
+
+// writeCheckpoint saves the checkpoint of the crawl in the state directory.
+func (s *testServer) writeCheckpoint(t *testing.T, id string, checkpoint string) {
+	dir := filepath.Join(s.stateDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "checkpoint.json"), []byte(checkpoint), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectCode(t *testing.T, w *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+	if w.Code != expected {
+		t.Errorf("invalid status code: got: %d, want: %d, body: %s", w.Code, expected, w.Body.String())
+	}
+}
+
+func TestHandleStartCrawl(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close()
+
+	view := s.start(t, "url=https://example.com/")
+	if view.ID == "" || len(view.Seeds) != 1 || view.Seeds[0] != "https://example.com/" {
+		t.Errorf("invalid crawl: %+v", view)
+	}
+	s.wait(t, view.ID)
+
+	if view := s.get(t, view.ID); view.Status != crawler.StatusComplete || view.Progress.Fetched != 1 {
+		t.Errorf("crawl should be complete, got: %+v", view)
+	}
+	w := s.do(http.MethodGet, "/crawls/"+view.ID+"/sitemap")
+	expectCode(t, w, http.StatusOK)
+	if body := w.Body.String(); body != "https://example.com/\n" {
+		t.Errorf("invalid sitemap: %q", body)
+	}
+	if status := w.Header().Get(headerCrawlStatus); status != string(crawler.StatusComplete) {
+		t.Errorf("invalid crawl status: got: %q, want: %q", status, crawler.StatusComplete)
+	}
+}
+
+func TestHandleStartCrawlDuplicateID(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close("duplicate")
+
+	s.start(t, "url=https://example.com"+hangingPath+"&crawl_id=duplicate")
+	expectCode(t, s.do(http.MethodPost, "/crawls?url=https://example.com/&crawl_id=duplicate"), http.StatusConflict)
+}
+
+func TestHandleStartCrawlFullStore(t *testing.T) {
+	s := newTestServer(t, 1)
+	defer s.close("first")
+
+	s.start(t, "url=https://example.com"+hangingPath+"&crawl_id=first")
+	expectCode(t, s.do(http.MethodPost, "/crawls?url=https://example.com/"), http.StatusTooManyRequests)
+}
+
+func TestHandleCrawlSitemapRunning(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close("running")
+
+	s.start(t, "url=https://example.com"+hangingPath+"&crawl_id=running")
+	expectCode(t, s.do(http.MethodGet, "/crawls/running/sitemap"), http.StatusConflict)
+	expectCode(t, s.do(http.MethodGet, "/crawls/missing/sitemap"), http.StatusNotFound)
+}
+
+func TestHandleSitemapCrawlIDInUse(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close("busy")
+
+	s.start(t, "url=https://example.com"+hangingPath+"&crawl_id=busy")
+	s.waitForHangingRequest(t)
+	expectCode(t, s.do(http.MethodGet, "/sitemap?url=https://example.com/&crawl_id=busy"), http.StatusConflict)
+}
+
+func TestHandleDeleteCrawl(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close("deleted")
+
+	s.start(t, "url=https://example.com"+hangingPath+"&crawl_id=deleted")
+	s.waitForHangingRequest(t)
+	// Running crawl is cancelled, but it's kept with its partial sitemap.
+	expectCode(t, s.do(http.MethodDelete, "/crawls/deleted"), http.StatusAccepted)
+	s.wait(t, "deleted")
+	if view := s.get(t, "deleted"); view.Status != crawler.StatusCancelled || view.Finished == nil {
+		t.Errorf("crawl should be cancelled, got: %+v", view)
+	}
+	expectCode(t, s.do(http.MethodGet, "/crawls/deleted/sitemap"), http.StatusOK)
+
+	// Finished crawl is removed.
+	expectCode(t, s.do(http.MethodDelete, "/crawls/deleted"), http.StatusNoContent)
+	expectCode(t, s.do(http.MethodGet, "/crawls/deleted"), http.StatusNotFound)
+	expectCode(t, s.do(http.MethodDelete, "/crawls/deleted"), http.StatusNotFound)
+}
+
+func TestHandleStartCrawlFailedResume(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close()
+
+	expectCode(t, s.do(http.MethodPost, "/crawls?resume=true&crawl_id=missing"), http.StatusNotFound)
+
+	// Checkpoint points to the frontier which doesn't exist, so the crawl fails when it's restored.
+	s.writeCheckpoint(t, "broken", `{"Generation":1,"Seeds":["https://example.com/"],"HistoryType":"memory"}`)
+	s.start(t, "resume=true&crawl_id=broken")
+	s.wait(t, "broken")
+
+	view := s.get(t, "broken")
+	if view.Status != crawler.StatusFailed || !strings.Contains(view.Error, "frontier") {
+		t.Errorf("crawl should fail, got: %+v", view)
+	}
+	expectCode(t, s.do(http.MethodGet, "/crawls/broken/sitemap"), http.StatusInternalServerError)
+}
+
+func TestHandleStartCrawlResumeLimits(t *testing.T) {
+	s := newTestServer(t, 10)
+	defer s.close()
+
+	// Checkpoint saved by the CLI might exceed the limits of the server.
+	s.writeCheckpoint(t, "unlimited", `{"Generation":1,"Seeds":["https://example.com/"],"HistoryType":"memory",
+		"Options":{"Workers":1000,"Timeout":60000000000,"History":{"Type":"memory","Capacity":100,"FalsePositiveRate":0.01}}}`)
+	expectCode(t, s.do(http.MethodPost, "/crawls?resume=true&crawl_id=unlimited"), http.StatusBadRequest)
+	expectCode(t, s.do(http.MethodGet, "/sitemap?resume=true&crawl_id=unlimited"), http.StatusBadRequest)
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/mwarzynski/crawler/internal/app"
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	"github.com/mwarzynski/crawler/pkg/logging"
+)
+
+// keepAliveInterval is the interval between the comments sent to the idle event streams, so the proxies
+// don't close the connection.
+const keepAliveInterval = 15 * time.Second
+
+// eventView is the JSON representation of the crawl event.
+type eventView struct {
+	Time       time.Time      `json:"time"`
+	URL        string         `json:"url,omitempty"`
+	Depth      int            `json:"depth,omitempty"`
+	StatusCode int            `json:"status_code,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+	Progress   *eventProgress `json:"progress,omitempty"`
+}
+
+type eventProgress struct {
+	Queued        int            `json:"queued"`
+	ActiveWorkers int            `json:"active_workers"`
+	Status        crawler.Status `json:"status"`
+	crawlProgress
+}
+
+func newEventView(event crawler.Event) eventView {
+	view := eventView{Time: event.Time}
+	if event.Type == crawler.EventProgress {
+		view.Progress = &eventProgress{
+			Queued:        event.Queued,
+			ActiveWorkers: event.ActiveWorkers,
+			Status:        event.Status,
+			crawlProgress: newCrawlProgress(event.Stats),
+		}
+		return view
+	}
+	view.URL = event.URL.String()
+	view.Depth = event.Depth
+	view.StatusCode = event.StatusCode
+	view.Reason = event.Reason
+	return view
+}
+
+// HandleCrawlEvents streams the events of the crawl as Server-Sent Events. The stream starts with the 'crawl'
+// event (the same as the response of HandleGetCrawl) and ends with the 'end' event once the crawl ends.
+func HandleCrawlEvents(crawls *app.CrawlStore, log logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := crawls.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		events, unsubscribe := c.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		if err := writeEvent(w, "crawl", newCrawlView(c)); err != nil {
+			log.Errorf("couldn't write event: %s", err)
+			return
+		}
+		flusher.Flush()
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					log.Errorf("couldn't write keep-alive: %s", err)
+					return
+				}
+				flusher.Flush()
+			case event, ok := <-events:
+				if !ok {
+					// Subscription is closed when the crawl ends, but its results are set right after that.
+					<-c.Done()
+					if err := writeEvent(w, "end", newCrawlView(c)); err != nil {
+						log.Errorf("couldn't write event: %s", err)
+					}
+					flusher.Flush()
+					return
+				}
+				if err := writeEvent(w, string(event.Type), newEventView(event)); err != nil {
+					log.Errorf("couldn't write event: %s", err)
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
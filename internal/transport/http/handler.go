@@ -3,36 +3,168 @@ package http
 import (
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
 
 	"github.com/mwarzynski/crawler/internal/app"
+	"github.com/mwarzynski/crawler/internal/app/crawler"
 	"github.com/mwarzynski/crawler/internal/app/crawler/sitemap"
 	"github.com/mwarzynski/crawler/pkg/logging"
 )
 
+// headerCrawlStatus tells how the crawl ended (complete, timeout, cancelled, page_limit).
+const headerCrawlStatus = "X-Crawl-Status"
+
 func HandleSitemap(service *app.Service, log logging.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		baseURLRaw := r.URL.Query().Get("url")
-		if baseURLRaw == "" {
-			http.Error(w, "provided url is empty", http.StatusBadRequest)
+		seeds, err := seedURLs(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
-		baseURL, err := url.Parse(baseURLRaw)
+		sitemapType, compression, err := sitemapFormat(r, "type")
 		if err != nil {
-			http.Error(w, "provided url is invalid", http.StatusUnprocessableEntity)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		sitemapType := sitemap.TypePlaintext
 
-		data, err := service.GenerateSitemap(ctx, *baseURL, sitemapType)
+		options, err := crawlOptions(r)
 		if err != nil {
+			http.Error(w, "provided crawl options are invalid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Resumed crawl continues at the seeds saved in its checkpoint.
+		if len(seeds) == 0 && !options.Checkpoint.Resume {
+			http.Error(w, "provided url is empty", http.StatusBadRequest)
+			return
+		}
+
+		data, status, err := service.GenerateSitemap(ctx, seeds, sitemapType, options)
+		switch errors.Cause(err) {
+		case nil:
+		case sitemap.ErrTooLarge:
+			// Child sitemaps of the index must be addressable, so they are served only for the crawl jobs.
+			http.Error(w, err.Error()+", start the crawl with POST /crawls to get the sitemap index",
+				http.StatusUnprocessableEntity)
+			return
+		case crawler.ErrCheckpointNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case app.ErrNoStateDir, crawler.ErrInvalidCheckpointOptions:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case app.ErrCrawlIDInUse:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		writeSitemap(w, r, data, status, contentType(sitemapType), compression, log)
+	}
+}
 
-		if _, err := w.Write(data); err != nil {
-			log.Errorf("couldn't write data: %s", err)
+// seedURLs reads the url params. The first url is the crawled site, others are additional seeds (e.g. orphan pages).
+func seedURLs(r *http.Request) ([]url.URL, error) {
+	seeds := make([]url.URL, 0)
+	for _, seedRaw := range r.URL.Query()["url"] {
+		if seedRaw == "" {
+			continue
+		}
+		seed, err := url.Parse(seedRaw)
+		if err != nil {
+			return nil, errors.New("provided url is invalid")
 		}
+		seeds = append(seeds, *seed)
+	}
+	return seeds, nil
+}
+
+// sitemapFormat reads the sitemap type (from the typeParam) and the requested compression of the file.
+func sitemapFormat(r *http.Request, typeParam string) (sitemap.Type, sitemap.Compression, error) {
+	sitemapType := sitemap.TypePlaintext
+	if t := r.URL.Query().Get(typeParam); t != "" {
+		parsedType, err := sitemap.ParseType(t)
+		if err != nil {
+			return "", "", err
+		}
+		sitemapType = parsedType
+	}
+	compression := sitemap.Compression(r.URL.Query().Get("compress"))
+	if compression != sitemap.CompressionNone && compression != sitemap.CompressionGzip {
+		return "", "", errors.New("provided compression is not supported")
+	}
+	return sitemapType, compression, nil
+}
+
+func writeSitemap(
+	w http.ResponseWriter,
+	r *http.Request,
+	data []byte,
+	status crawler.Status,
+	contentType string,
+	compression sitemap.Compression,
+	log logging.Logger,
+) {
+	// Partial sitemap (e.g. crawl timed out) is still useful, but the client should know it's incomplete.
+	w.Header().Set(headerCrawlStatus, string(status))
+
+	// Compressed file was explicitly requested (e.g. to be stored as sitemap.txt.gz).
+	// Otherwise, we compress the response if client accepts it (transparent for the client).
+	w.Header().Set("Content-Type", contentType)
+	switch {
+	case compression == sitemap.CompressionGzip:
+		w.Header().Set("Content-Type", "application/gzip")
+	case acceptsGzip(r):
+		compression = sitemap.CompressionGzip
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	data, err := sitemap.Compress(data, compression)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := w.Write(data); err != nil {
+		log.Errorf("couldn't write data: %s", err)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(encoding, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		// Client might explicitly refuse the encoding with 'q=0'.
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func contentType(t sitemap.Type) string {
+	switch t {
+	case sitemap.TypeXML:
+		return "application/xml; charset=utf-8"
+	case sitemap.TypeRSS:
+		return "application/rss+xml; charset=utf-8"
+	case sitemap.TypeAtom:
+		return "application/atom+xml; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
 	}
 }
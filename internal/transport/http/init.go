@@ -11,7 +11,16 @@ import (
 	"github.com/mwarzynski/crawler/pkg/logging"
 )
 
-func Init(addr string, service *app.Service, log logging.Logger) error {
+func Init(addr string, service *app.Service, crawls *app.CrawlStore, log logging.Logger) error {
+	go func() {
+		if err := http.ListenAndServe("localhost:6060", nil); err != nil {
+			log.Errorf("pprof ListenAndServe: %s", err.Error())
+		}
+	}()
+	return http.ListenAndServe(addr, newRouter(service, crawls, log))
+}
+
+func newRouter(service *app.Service, crawls *app.CrawlStore, log logging.Logger) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
@@ -20,6 +29,12 @@ func Init(addr string, service *app.Service, log logging.Logger) error {
 	r.Use(middleware.Recoverer)
 
 	r.Get("/sitemap", HandleSitemap(service, log))
+	r.Post("/crawls", HandleStartCrawl(service, crawls, log))
+	r.Get("/crawls/{id}", HandleGetCrawl(crawls, log))
+	r.Get("/crawls/{id}/sitemap", HandleCrawlSitemap(crawls, log))
+	r.Get("/crawls/{id}/sitemap/{name}", HandleCrawlSitemapFile(crawls, log))
+	r.Get("/crawls/{id}/events", HandleCrawlEvents(crawls, log))
+	r.Delete("/crawls/{id}", HandleDeleteCrawl(crawls))
 
 	// TODO: We would set up 'management' server for these endpoints (that would serve on a different port).
 	// In case prometheus is used for metrics, we would add /metrics at this secondary server as well.
@@ -29,11 +44,5 @@ func Init(addr string, service *app.Service, log logging.Logger) error {
 	r.Get("/liveness", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
-
-	go func() {
-		if err := http.ListenAndServe("localhost:6060", nil); err != nil {
-			log.Errorf("pprof ListenAndServe: %s", err.Error())
-		}
-	}()
-	return http.ListenAndServe(addr, r)
+	return r
 }
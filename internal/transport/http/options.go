@@ -0,0 +1,207 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mwarzynski/crawler/internal/app/crawler"
+	"github.com/mwarzynski/crawler/internal/app/crawler/filter"
+	"github.com/mwarzynski/crawler/internal/app/crawler/http/url_extractor"
+)
+
+// Limits of the crawls started by the clients. Crawls run on the server (also in the background, see POST /crawls),
+// so unlike the CLI, they can't be unlimited.
+const (
+	maxWorkers         = 50
+	maxTimeout         = 24 * time.Hour
+	maxRequestTimeout  = 5 * time.Minute
+	maxHistoryCapacity = 10000000
+)
+
+// crawlOptions reads the crawl configuration from the query params.
+func crawlOptions(r *http.Request) (crawler.CrawlOptions, error) {
+	query := r.URL.Query()
+	options := crawler.DefaultCrawlOptions()
+	var err error
+
+	options.URLNormalization.AllowedParams = url_extractor.SplitList(query.Get("allow_params"))
+	options.URLNormalization.DeniedParams = url_extractor.SplitList(query.Get("deny_params"))
+	if v := query.Get("sort_params"); v != "" {
+		sortParams, err := strconv.ParseBool(v)
+		if err != nil {
+			return options, err
+		}
+		options.URLNormalization.SortParams = sortParams
+	}
+	if v := query.Get("keep_tracking_params"); v != "" {
+		keepTrackingParams, err := strconv.ParseBool(v)
+		if err != nil {
+			return options, err
+		}
+		options.URLNormalization.StripTrackingParams = !keepTrackingParams
+	}
+	if v := query.Get("partial"); v != "" {
+		if options.PartialResults, err = strconv.ParseBool(v); err != nil {
+			return options, err
+		}
+	}
+	if options.Workers, err = intParam(query.Get("workers"), options.Workers); err != nil {
+		return options, err
+	}
+	if options.MaxPages, err = intParam(query.Get("max_pages"), options.MaxPages); err != nil {
+		return options, err
+	}
+	if options.MaxDepth, err = intParam(query.Get("max_depth"), options.MaxDepth); err != nil {
+		return options, err
+	}
+	if options.Timeout, err = durationParam(query.Get("timeout"), options.Timeout); err != nil {
+		return options, err
+	}
+	if options.RequestTimeout, err = durationParam(query.Get("request_timeout"), options.RequestTimeout); err != nil {
+		return options, err
+	}
+	// Crawl trap limits (0 disables the heuristic).
+	traps := &options.Traps
+	if traps.MaxPathDepth, err = intParam(query.Get("max_path_depth"), traps.MaxPathDepth); err != nil {
+		return options, err
+	}
+	if traps.MaxRepeatedSegments, err = intParam(query.Get("max_repeated_segments"), traps.MaxRepeatedSegments); err != nil {
+		return options, err
+	}
+	if traps.MaxURLsPerPattern, err = intParam(query.Get("max_urls_per_pattern"), traps.MaxURLsPerPattern); err != nil {
+		return options, err
+	}
+	if traps.MaxCalendarURLs, err = intParam(query.Get("max_calendar_urls"), traps.MaxCalendarURLs); err != nil {
+		return options, err
+	}
+
+	if v := query.Get("seed_sitemaps"); v != "" {
+		if options.SeedFromSitemaps, err = strconv.ParseBool(v); err != nil {
+			return options, err
+		}
+	}
+	// Queue directory is decided by the server (system temporary directory).
+	if v := query.Get("queue"); v != "" {
+		if options.Queue.Type, err = crawler.ParseQueueType(v); err != nil {
+			return options, err
+		}
+	}
+	// History directory is decided by the server as well.
+	if v := query.Get("history"); v != "" {
+		if options.History.Type, err = crawler.ParseHistoryType(v); err != nil {
+			return options, err
+		}
+	}
+	if options.History.Capacity, err = intParam(query.Get("history_capacity"), options.History.Capacity); err != nil {
+		return options, err
+	}
+	if v := query.Get("history_fp_rate"); v != "" {
+		if options.History.FalsePositiveRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return options, err
+		}
+	}
+	if err := checkLimits(options); err != nil {
+		return options, err
+	}
+	// Checkpoints are saved in the server's state directory, if the crawl ID is specified.
+	if id := query.Get("crawl_id"); id != "" {
+		if err := crawler.ValidateCrawlID(id); err != nil {
+			return options, err
+		}
+		options.Checkpoint.ID = id
+	}
+	if v := query.Get("resume"); v != "" {
+		if options.Checkpoint.Resume, err = strconv.ParseBool(v); err != nil {
+			return options, err
+		}
+		if options.Checkpoint.Resume && options.Checkpoint.ID == "" {
+			return options, errors.Errorf("crawl_id is required to resume the crawl")
+		}
+	}
+	if v := query.Get("incremental"); v != "" {
+		if options.Incremental.Enabled, err = strconv.ParseBool(v); err != nil {
+			return options, err
+		}
+	}
+	if v := query.Get("scope"); v != "" {
+		if options.Scope.Mode, err = crawler.ParseScopeMode(v); err != nil {
+			return options, err
+		}
+	}
+	options.Scope.Hosts = url_extractor.SplitList(query.Get("hosts"))
+	if v := query.Get("strict_scheme"); v != "" {
+		if options.Scope.StrictScheme, err = strconv.ParseBool(v); err != nil {
+			return options, err
+		}
+	}
+	if options.CrawlFilter, err = filter.Parse(query["include"], query["exclude"]); err != nil {
+		return options, err
+	}
+	if options.SitemapFilter, err = filter.Parse(query["sitemap_include"], query["sitemap_exclude"]); err != nil {
+		return options, err
+	}
+
+	trailingSlash, err := url_extractor.ParseTrailingSlash(query.Get("trailing_slash"))
+	if err != nil {
+		return options, err
+	}
+	options.URLNormalization.TrailingSlash = trailingSlash
+	// Resumed crawl continues with the options saved in its checkpoint, they must be within the limits as well.
+	options.ResumeCheck = checkLimits
+
+	return options, nil
+}
+
+// checkLimits checks that the crawl doesn't exceed the limits of the server.
+func checkLimits(options crawler.CrawlOptions) error {
+	if options.Workers < 1 || options.Workers > maxWorkers {
+		return errors.Errorf("workers must be between 1 and %d", maxWorkers)
+	}
+	if options.Timeout <= 0 || options.Timeout > maxTimeout {
+		return errors.Errorf("timeout must be positive and at most %s", maxTimeout)
+	}
+	if options.RequestTimeout < 0 || options.RequestTimeout > maxRequestTimeout {
+		return errors.Errorf("request timeout must be at most %s", maxRequestTimeout)
+	}
+	if options.History.Capacity < 1 || options.History.Capacity > maxHistoryCapacity {
+		return errors.Errorf("history capacity must be between 1 and %d", maxHistoryCapacity)
+	}
+	// Negated, so NaN is rejected as well.
+	if rate := options.History.FalsePositiveRate; !(rate > 0 && rate < 1) {
+		return errors.Errorf("history false positive rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// intParam parses the non-negative integer param, returns the default value if the param is not set.
+func intParam(v string, defaultValue int) (int, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, errors.Errorf("value '%s' must not be negative", v)
+	}
+	return i, nil
+}
+
+// durationParam parses the non-negative duration param (e.g. '5m'), returns the default value if the param is not set.
+func durationParam(v string, defaultValue time.Duration) (time.Duration, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.Errorf("duration '%s' must not be negative", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawlOptionsLimits(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{"workers=50", true},
+		{"workers=51", false},
+		{"timeout=24h", true},
+		{"timeout=25h", false},
+		{"request_timeout=6m", false},
+		{"history_capacity=10000000", true},
+		{"history_capacity=10000001", false},
+		{"history_capacity=0", false},
+		{"history_fp_rate=0.01", true},
+		{"history_fp_rate=0", false},
+		{"history_fp_rate=1", false},
+		{"history_fp_rate=NaN", false},
+		{"history_fp_rate=Inf", false},
+		{"history_fp_rate=-Inf", false},
+	}
+	for _, test := range tests {
+		_, err := crawlOptions(httptest.NewRequest("GET", "/crawls?"+test.query, nil))
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", test.query, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: error expected", test.query)
+		}
+	}
+}